@@ -0,0 +1,113 @@
+package dccli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+)
+
+// AddressMode selects how Compose.Address reaches the containers of a service.
+type AddressMode int
+
+const (
+	// AddressAuto uses the container IP if the process runs in a container attached to the project networks
+	// by OptionAttachSelf, and otherwise the published port if there is one and the container IP if there is not.
+	AddressAuto AddressMode = iota
+	// AddressPublished uses the Docker host and the host port the container port is published on.
+	AddressPublished
+	// AddressContainer uses the IP of the container and the container port,
+	// which is only reachable from the Docker host or from containers on the same network.
+	AddressContainer
+)
+
+func (m AddressMode) String() string {
+	switch m {
+	case AddressPublished:
+		return "published"
+	case AddressContainer:
+		return "container"
+	}
+	return "auto"
+}
+
+// Address returns the host:port the given container port of the first container of the service can be reached at,
+// using the mode set by OptionAddressMode.
+func (c *Compose) Address(service string, port uint32) (string, error) {
+	container, err := c.cachedContainer(service)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case c.cfg.addressMode == AddressPublished:
+		return c.publishedAddress(container, port)
+	case c.cfg.addressMode == AddressContainer || len(c.selfNetworks) > 0:
+		return c.containerAddress(container, port)
+	}
+	addr, err := c.publishedAddress(container, port)
+	if err == nil {
+		return addr, nil
+	}
+	if addr, cerr := c.containerAddress(container, port); cerr == nil {
+		return addr, nil
+	}
+	return "", fmt.Errorf("compose: no address for port %d of service %s: %w", port, service, err)
+}
+
+// publishedAddress returns the Docker host and the host port the container port is published on.
+func (c *Compose) publishedAddress(container *ContainerInfo, port uint32) (string, error) {
+	public, err := container.GetFirstPublicPort(port, "tcp")
+	if err != nil {
+		return "", err
+	}
+	host, err := c.publishHost(context.Background())
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.FormatUint(uint64(public), 10)), nil
+}
+
+// publishHost returns the host published ports are reached at. It is resolved on first use and kept once a lookup
+// succeeds, as resolving reads the Docker config and may look up host names, which would slow down every attempt of a
+// probe. A failed or cancelled lookup is not kept, so the next call tries again.
+func (c *Compose) publishHost(ctx context.Context) (string, error) {
+	if c.dockerHost != "" {
+		return c.dockerHost, nil
+	}
+	host, err := inferDockerHost(ctx, c.cfg.executor)
+	if err != nil {
+		return "", err
+	}
+	if ctx.Err() == nil {
+		c.dockerHost = host
+	}
+	return host, nil
+}
+
+// containerAddress returns the IP of the container and the container port. The IPs on the networks attachSelf
+// connected to and on the default network of the project are preferred, falling back to the first network by name
+// the container has an IP on.
+func (c *Compose) containerAddress(container *ContainerInfo, port uint32) (string, error) {
+	candidates := append(append([]string(nil), c.selfNetworks...), c.cfg.projectName+"_default")
+	if container.NetworkSettings != nil {
+		names := make([]string, 0, len(container.NetworkSettings.Networks))
+		for name := range container.NetworkSettings.Networks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		candidates = append(candidates, names...)
+	}
+	var ip string
+	for _, name := range candidates {
+		if found, err := container.IPOnNetwork(name); err == nil {
+			ip = found
+			break
+		}
+	}
+	if ip == "" {
+		return "", fmt.Errorf("compose: container '%v' has no IP address", container.Name)
+	}
+	return net.JoinHostPort(ip, strconv.FormatUint(uint64(port), 10)), nil
+}
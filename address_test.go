@@ -0,0 +1,92 @@
+package dccli
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const networkInspectOutput = `{
+  "Id": "4d3c1b2a0f9e",
+  "Name": "/dccli_ms_1",
+  "Config": {"Labels": {"com.docker.compose.project": "dccli", "com.docker.compose.service": "ms"}},
+  "NetworkSettings": {
+    "Ports": {"3000/tcp": [{"HostIp": "0.0.0.0", "HostPort": "32768"}], "1090/tcp": null},
+    "Networks": {
+      "dccli_backend": {
+        "NetworkID": "b1",
+        "IPAddress": "172.19.0.2",
+        "IPPrefixLen": 16,
+        "Gateway": "172.19.0.1",
+        "MacAddress": "02:42:ac:13:00:02",
+        "Aliases": ["ms", "api"]
+      },
+      "dccli_default": {
+        "NetworkID": "d1",
+        "IPAddress": "172.18.0.3",
+        "Gateway": "172.18.0.1",
+        "GlobalIPv6Address": "fd00::3"
+      }
+    }
+  }
+}`
+
+// addressCompose returns a replayCompose whose "ms" container is on the networks of networkInspectOutput.
+func addressCompose(t *testing.T, mode AddressMode) *Compose {
+	var container ContainerInfo
+	require.NoError(t, json.Unmarshal([]byte(networkInspectOutput), &container))
+	return replayCompose(t, nil, withContainer("ms", &container), withOptions(OptionAddressMode(mode)))
+}
+
+func TestIPOnNetwork(t *testing.T) {
+	container := addressCompose(t, AddressAuto).containers["ms"][0]
+
+	backend := container.NetworkSettings.Networks["dccli_backend"]
+	require.Equal(t, &EndpointSettings{
+		NetworkID:   "b1",
+		IPAddress:   "172.19.0.2",
+		IPPrefixLen: 16,
+		Gateway:     "172.19.0.1",
+		MacAddress:  "02:42:ac:13:00:02",
+		Aliases:     []string{"ms", "api"},
+	}, backend)
+	require.Equal(t, "fd00::3", container.NetworkSettings.Networks["dccli_default"].GlobalIPv6Address)
+
+	ip, err := container.IPOnNetwork("dccli_backend")
+	require.NoError(t, err)
+	require.Equal(t, "172.19.0.2", ip)
+	ip, err = container.IPOnNetwork("default")
+	require.NoError(t, err, "compose network names are prefixed with the project")
+	require.Equal(t, "172.18.0.3", ip)
+	_, err = container.IPOnNetwork("frontend")
+	require.Error(t, err)
+}
+
+func TestAddress(t *testing.T) {
+	c := addressCompose(t, AddressAuto)
+	addr, err := c.Address("ms", 3000)
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1:32768", addr, "published ports are preferred")
+	addr, err = c.Address("ms", 1090)
+	require.NoError(t, err)
+	require.Equal(t, "172.18.0.3:1090", addr, "unpublished ports fall back to the project's default network")
+	_, err = c.Address("mysql", 3306)
+	require.Error(t, err)
+	setEnv(t, "DOCKER_HOST", "tcp://10.0.0.5:2375")
+	addr, err = c.Address("ms", 3000)
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1:32768", addr, "the Docker host is only resolved once")
+
+	c = addressCompose(t, AddressContainer)
+	addr, err = c.Address("ms", 3000)
+	require.NoError(t, err)
+	require.Equal(t, "172.18.0.3:3000", addr)
+	delete(c.containers["ms"][0].NetworkSettings.Networks, "dccli_default")
+	addr, err = c.Address("ms", 3000)
+	require.NoError(t, err)
+	require.Equal(t, "172.19.0.2:3000", addr)
+
+	c = addressCompose(t, AddressPublished)
+	_, err = c.Address("ms", 1090)
+	require.Error(t, err)
+}
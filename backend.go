@@ -0,0 +1,67 @@
+package dccli
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Backend selects which Docker Compose implementation is used to run the configuration.
+type Backend int
+
+const (
+	// BackendAuto uses the Docker Compose v2 plugin when it is available,
+	// and falls back to the standalone docker-compose binary otherwise.
+	BackendAuto Backend = iota
+	// BackendV1 runs the standalone (python) docker-compose binary.
+	BackendV1
+	// BackendV2 runs the `docker compose` plugin.
+	BackendV2
+)
+
+var (
+	v1ProjectNameRegexp = regexp.MustCompile(`[^a-z0-9]`)
+	v2ProjectNameRegexp = regexp.MustCompile(`[^a-z0-9_-]`)
+)
+
+func (b Backend) String() string {
+	switch b {
+	case BackendAuto:
+		return "auto"
+	case BackendV1:
+		return "docker-compose"
+	case BackendV2:
+		return "docker compose"
+	}
+	return fmt.Sprintf("Backend(%d)", int(b))
+}
+
+// command returns the program and the leading arguments used to invoke the backend.
+func (b Backend) command() (string, []string) {
+	if b == BackendV2 {
+		return "docker", []string{"compose"}
+	}
+	return "docker-compose", nil
+}
+
+// detectBackend resolves BackendAuto to the backend installed on the host.
+func detectBackend(ctx context.Context, e Executor) Backend {
+	if _, err := runCmd(ctx, e, "docker", "compose", "version"); err == nil {
+		return BackendV2
+	}
+	return BackendV1
+}
+
+// normalizeProjectName applies the project naming rules of the given backend,
+// so the name we use matches the one docker compose puts on containers and networks.
+func normalizeProjectName(b Backend, name string) string {
+	name = strings.ToLower(name)
+	if b == BackendV2 {
+		// v2 keeps dashes and underscores, but the name has to start with a letter or a digit
+		return strings.TrimLeft(v2ProjectNameRegexp.ReplaceAllString(name, ""), "_-")
+	}
+	// docker-compose 1.21 and later also keep dashes and underscores, but earlier versions keep nothing but letters and
+	// digits. The stricter rule is kept on purpose, so every v1 version accepts the name and uses it unchanged.
+	return v1ProjectNameRegexp.ReplaceAllString(name, "")
+}
@@ -7,13 +7,14 @@ package dccli
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"gopkg.in/yaml.v2"
 	"log"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 )
@@ -22,16 +23,31 @@ import (
 type Compose struct {
 	ids         []string
 	publicCfg   Config
-	containers  map[string]*ContainerInfo
+	containers  map[string][]*ContainerInfo
 	fileName    string
 	projectName string
 	logger      *log.Logger
 	cfg         internalCFG
+	reaper      *reaper
+	// stops the log followers started by LogsTo
+	logFollowers []func(grace time.Duration)
+	// the container the process runs in and the networks attachSelf connected it to
+	selfID       string
+	selfNetworks []string
+	// the host published ports are reached at, see publishHost
+	dockerHost string
 }
 
 var (
-	defaultLogger   = log.New(os.Stdout, "[dccli] ", log.LstdFlags|log.Lshortfile)
-	composeUpRegexp = regexp.MustCompile(`(?m)docker start|inspect_container <-.*\(u?'(.*)'\)`)
+	defaultLogger     = log.New(os.Stdout, "[dccli] ", log.LstdFlags|log.Lshortfile)
+	containerIDRegexp = regexp.MustCompile(`^[0-9a-f]{12,64}$`)
+)
+
+// Labels docker-compose attaches to every container it creates.
+const (
+	labelProject = "com.docker.compose.project"
+	labelService = "com.docker.compose.service"
+	labelNumber  = "com.docker.compose.container-number"
 )
 
 type internalCFG struct {
@@ -44,6 +60,27 @@ type internalCFG struct {
 	keeparound   bool
 	preventStop  bool
 	outFile      string
+	backend      Backend
+	executor     Executor
+	waitHealthy  time.Duration
+	probes       []serviceProbes
+	pruneVolumes bool
+	reaper       bool
+	artifactDir  string
+	scale        map[string]int
+	services     []string
+	composeFiles []string
+	lookupEnv    LookupFunc
+	envFiles     []string
+	addressMode  AddressMode
+	attachSelf   bool
+}
+
+// serviceProbes holds the probes Start waits on for a single service.
+type serviceProbes struct {
+	service string
+	policy  RetryPolicy
+	probes  []Probe
 }
 
 // Option is the type used for defining optional configuration
@@ -77,6 +114,21 @@ func OptionPreventStop(b bool) Option {
 	}
 }
 
+// If OptionPruneVolumes is true, cleanup also prunes every dangling volume on the host, not just the ones of the project.
+func OptionPruneVolumes(b bool) Option {
+	return func(c *internalCFG) {
+		c.pruneVolumes = b
+	}
+}
+
+// If OptionReaper is true, a watchdog process brings the project down once the current process exits
+// without having called Cleanup, for example after a panic or a SIGKILL.
+func OptionReaper(b bool) Option {
+	return func(c *internalCFG) {
+		c.reaper = b
+	}
+}
+
 // OptionWithCompose sets the compose file to use during start
 func OptionWithCompose(o Config) Option {
 	return func(c *internalCFG) {
@@ -84,13 +136,33 @@ func OptionWithCompose(o Config) Option {
 	}
 }
 
-// OptionWithProjectName sets the project name to use
+// OptionWithComposeFiles loads the configuration from the given docker-compose files during start,
+// merging them like LoadConfig does. It takes precedence over OptionWithCompose.
+func OptionWithComposeFiles(paths ...string) Option {
+	return func(c *internalCFG) {
+		c.composeFiles = paths
+	}
+}
+
+// OptionLookupEnv sets the function variables in the configuration are interpolated with, defaults to os.LookupEnv.
+func OptionLookupEnv(lookup LookupFunc) Option {
+	return func(c *internalCFG) {
+		c.lookupEnv = lookup
+	}
+}
+
+// OptionEnvFile adds a .env file whose variables are used for interpolation when they are not found by the lookup
+// function. Variables of files added later take precedence.
+func OptionEnvFile(path string) Option {
+	return func(c *internalCFG) {
+		c.envFiles = append(c.envFiles, path)
+	}
+}
+
+// OptionWithProjectName sets the project name to use.
+// The name is normalized according to the rules of the selected Backend during Start.
 func OptionWithProjectName(p string) Option {
 	return func(c *internalCFG) {
-		if p != "" {
-			// lowercases everything and strips out all underscores
-			p = strings.Replace(strings.ToLower(p), "_", "", -1)
-		}
 		c.projectName = p
 	}
 }
@@ -109,6 +181,77 @@ func OptionStartRetries(count int) Option {
 	}
 }
 
+// OptionBackend selects the docker compose implementation to use, defaults to BackendAuto.
+func OptionBackend(b Backend) Option {
+	return func(c *internalCFG) {
+		c.backend = b
+	}
+}
+
+// OptionWithExecutor sets the Executor used to run the docker and docker compose commands.
+func OptionWithExecutor(e Executor) Option {
+	return func(c *internalCFG) {
+		c.executor = e
+	}
+}
+
+// OptionWaitHealthy makes Start wait up to timeout for every container with a healthcheck to report healthy.
+// Start fails early once one of them reports unhealthy or exits.
+func OptionWaitHealthy(timeout time.Duration) Option {
+	return func(c *internalCFG) {
+		c.waitHealthy = timeout
+	}
+}
+
+// OptionWaitFor makes Start wait until all the probes succeed for the given service, retrying as dictated by policy.
+// A nil policy retries with exponential backoff.
+func OptionWaitFor(service string, policy RetryPolicy, probes ...Probe) Option {
+	return func(c *internalCFG) {
+		c.probes = append(c.probes, serviceProbes{service: service, policy: policy, probes: probes})
+	}
+}
+
+// OptionArtifactDir sets the directory StartT writes the logs and container state of failed tests to,
+// defaults to a dccli-artifacts directory in the temp directory.
+func OptionArtifactDir(dir string) Option {
+	return func(c *internalCFG) {
+		c.artifactDir = dir
+	}
+}
+
+// OptionScale starts n containers for the service instead of one.
+func OptionScale(service string, n int) Option {
+	return func(c *internalCFG) {
+		if c.scale == nil {
+			c.scale = make(map[string]int)
+		}
+		c.scale[service] = n
+	}
+}
+
+// OptionServices starts only the given services, along with the services they depend on,
+// instead of every service of the configuration. More services can be started later with Compose.Up.
+func OptionServices(services ...string) Option {
+	return func(c *internalCFG) {
+		c.services = services
+	}
+}
+
+// OptionAddressMode sets how Compose.Address and the probes reach services, defaults to AddressAuto.
+func OptionAddressMode(mode AddressMode) Option {
+	return func(c *internalCFG) {
+		c.addressMode = mode
+	}
+}
+
+// If OptionAttachSelf is true and the process runs inside a container, Start connects that container to the networks
+// of the project, so the services can be reached by their container IPs. Cleanup disconnects it again.
+func OptionAttachSelf(b bool) Option {
+	return func(c *internalCFG) {
+		c.attachSelf = b
+	}
+}
+
 func OptionWriteToFile(path string) Option {
 	return func(c *internalCFG) {
 		c.outFile = path
@@ -118,10 +261,35 @@ func OptionWriteToFile(path string) Option {
 // Start starts a Docker Compose configuration.
 // TODO(mclemens) accept an io.Reader or a set of options
 func Start(opts ...Option) (*Compose, error) {
+	return StartContext(context.Background(), opts...)
+}
+
+// StartContext is like Start, but aborts pulling and starting the containers once ctx is done.
+// If the containers fail to start or do not become ready, they are cleaned up before returning the error.
+func StartContext(ctx context.Context, opts ...Option) (*Compose, error) {
+	c, err := startContext(ctx, opts...)
+	if err != nil {
+		if c != nil {
+			// the caller gets no Compose to clean up with, and cleaning up has to happen even if ctx is done
+			if err := c.CleanupContext(context.Background()); err != nil {
+				c.logger.Printf("error cleaning up after failing to start: %v", err)
+			}
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// startContext starts the configuration, returning the Compose along with the error once starting the containers was
+// attempted, but starting, attaching to or waiting for them failed.
+func startContext(ctx context.Context, opts ...Option) (*Compose, error) {
 	cfg := internalCFG{
 		projectName:  "dccli",
 		logger:       defaultLogger,
 		connectTries: 3,
+		executor:     ExecExecutor{},
+		lookupEnv:    os.LookupEnv,
+		artifactDir:  filepath.Join(os.TempDir(), "dccli-artifacts"),
 	}
 
 	for _, opt := range opts {
@@ -130,24 +298,41 @@ func Start(opts ...Option) (*Compose, error) {
 
 	cfg.logger.Println("initializing...")
 
-	// we deep copy the config to not overwrite the passed in configuration
-	bs, err := yaml.Marshal(&cfg.compose)
+	lookup, err := envLookup(cfg.lookupEnv, cfg.envFiles)
 	if err != nil {
 		return nil, err
 	}
+	// files are interpolated while loading, so only a configuration passed in is interpolated here,
+	// which works on a deep copy and leaves the passed in configuration alone
 	var cmpCFG Config
-	yaml.Unmarshal(bs, &cmpCFG)
+	if len(cfg.composeFiles) > 0 {
+		cmpCFG, err = loadConfig(lookup, cfg.composeFiles)
+	} else {
+		cmpCFG, err = Interpolate(cfg.compose, lookup)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.backend == BackendAuto {
+		cfg.backend = detectBackend(ctx, cfg.executor)
+	}
+	cfg.projectName = normalizeProjectName(cfg.backend, cfg.projectName)
+	cfg.logger.Printf("using %s with project name: %s", cfg.backend, cfg.projectName)
 
-	// we remove networks across the top level config as well as the services,
-	// for we rely on the default network that is set per project
-	cmpCFG.Networks = nil
-	for k, svc := range cmpCFG.Services {
-		updatedSVC := svc
-		updatedSVC.Networks = nil
-		cmpCFG.Services[k] = updatedSVC
+	if err := cmpCFG.Validate(); err != nil {
+		return nil, err
+	}
+
+	// with the reaper enabled, the written file labels every service with the current session, so ReapStale
+	// can find them if we never clean up. The labels change the config hash of every service, so they are left
+	// out otherwise to keep reusing the containers of earlier runs.
+	written := cmpCFG
+	if cfg.reaper {
+		written = withSessionLabels(cmpCFG, time.Now())
 	}
 
-	bsMod, err := yaml.Marshal(&cmpCFG)
+	bsMod, err := marshalEscaped(written)
 	if err != nil {
 		return nil, err
 	}
@@ -176,49 +361,53 @@ func Start(opts ...Option) (*Compose, error) {
 
 	if cfg.forcePull {
 		cfg.logger.Println("pulling images...")
-		if _, err := composeRun(cfg.outFile, cfg.projectName, "pull"); err != nil {
-			return nil, fmt.Errorf("compose: error pulling images: %v", err)
+		if _, err := composeRun(ctx, &cfg, "pull"); err != nil {
+			return nil, fmt.Errorf("compose: error pulling images: %w", err)
 		}
 	}
 
 	if cfg.rmFirst {
 		cfg.logger.Println("WARN: OptionRMFirst is slow and wasteful, don't use it.")
 		cfg.logger.Println("killing and removing images...")
-		if err := composeKill(cfg.outFile, cfg.projectName); err != nil {
+		if err := composeKill(ctx, &cfg); err != nil {
 			return nil, err
 		}
-		if err := composeRm(cfg.outFile, cfg.projectName); err != nil {
+		if err := composeRm(ctx, &cfg); err != nil {
 			return nil, err
 		}
 	}
 
 	c := &Compose{
-		ids:         nil, // will be filled in via connect
+		ids:         nil, // will be filled in via updateContainers
 		publicCfg:   cmpCFG,
-		containers:  make(map[string]*ContainerInfo),
+		containers:  make(map[string][]*ContainerInfo),
 		fileName:    cfg.outFile,
 		projectName: cfg.projectName,
 		logger:      cfg.logger,
 		cfg:         cfg,
 	}
+	if cfg.reaper {
+		if c.reaper, err = startReaper(&c.cfg); err != nil {
+			return nil, err
+		}
+	}
 
-	err = connect(cfg.connectTries, time.Second*2, func() error {
-		out, err := composeRun(cfg.outFile, cfg.projectName, "--verbose", "up", "-d")
-		if err != nil {
+	// nil when starting everything
+	services, err := dependencyClosure(cmpCFG, cfg.services)
+	if err != nil {
+		return nil, err
+	}
+
+	upArgs := append([]string{"up", "-d"}, scaleArgs(cfg.scale, services)...)
+	upArgs = append(upArgs, services...)
+
+	err = connect(ctx, cfg.connectTries, time.Second*2, func() error {
+		if _, err := composeRun(ctx, &c.cfg, upArgs...); err != nil {
 			return err
 		}
 		cfg.logger.Println("containers started")
 
-		matches := composeUpRegexp.FindAllStringSubmatch(out, -1)
-		var ids []string
-		for _, match := range matches {
-			if match[1] != "" {
-				ids = append(ids, match[1])
-			}
-		}
-		c.ids = ids
-
-		if err := c.updateContainers(); err != nil {
+		if err := c.updateContainers(ctx); err != nil {
 			cfg.logger.Printf("retrying after: %s\n", err)
 			return err
 		}
@@ -226,16 +415,28 @@ func Start(opts ...Option) (*Compose, error) {
 		return nil
 	})
 	if err != nil {
-		return nil, fmt.Errorf("compose: error starting containers: %v", err)
+		// up was attempted, so some of the containers may be running and have to be cleaned up
+		return c, fmt.Errorf("compose: error starting containers: %w", err)
+	}
+	if cfg.attachSelf {
+		if err := c.attachSelf(ctx); err != nil {
+			return c, err
+		}
+	}
+
+	if err := c.waitReady(ctx, services); err != nil {
+		return c, err
 	}
 
 	var containerNames []string
 	for k := range c.containers {
 		containerNames = append(containerNames, k)
 	}
+	sort.Strings(containerNames)
 
 	c.logger.Println("done initializing...")
-	c.logger.Printf("Tail logs via: docker-compose -p %s -f %s logs -f %s\n",
+	c.logger.Printf("Tail logs via: %s -p %s -f %s logs -f %s\n",
+		cfg.backend,
 		cfg.projectName,
 		cfg.outFile,
 		strings.Join(containerNames, " "))
@@ -243,33 +444,154 @@ func Start(opts ...Option) (*Compose, error) {
 	return c, nil
 }
 
-func (c *Compose) updateContainers() error {
+// Up starts the given services, along with the services they depend on, in the running project.
+// It waits for them in the same way Start does.
+func (c *Compose) Up(services ...string) error {
+	return c.UpContext(context.Background(), services...)
+}
 
-	for _, id := range c.ids {
-		container, err := Inspect(id)
-		if err != nil {
+// UpContext is like Up, but gives up on starting and waiting for the services once ctx is done.
+func (c *Compose) UpContext(ctx context.Context, services ...string) error {
+	services, err := dependencyClosure(c.publicCfg, services)
+	if err != nil {
+		return err
+	}
+	// without the --scale flags, docker compose scales the services back to a single container
+	upArgs := append([]string{"up", "-d"}, scaleArgs(c.cfg.scale, services)...)
+	if _, err := composeRun(ctx, &c.cfg, append(upArgs, services...)...); err != nil {
+		return fmt.Errorf("compose: error starting services %v: %w", services, err)
+	}
+	if err := c.updateContainers(ctx); err != nil {
+		return err
+	}
+	if c.cfg.attachSelf {
+		if err := c.attachSelf(ctx); err != nil {
 			return err
 		}
-		//if !container.State.Running {
-		//	c.logger.Printf("compose: container '%v' is not yet running\n", container.Name)
-		//}
-		key := container.Name[1:]
-		key = findKey(key, c.publicCfg.Services)
-		if key == "" {
-			return fmt.Errorf("could not map key: %s, to list of services", key)
+	}
+	return c.waitReady(ctx, services)
+}
+
+// scaleArgs returns the --scale flags for the scaled services among services, or for every scaled service if nil.
+func scaleArgs(scale map[string]int, services []string) []string {
+	var scaled []string
+	for service := range scale {
+		if services == nil || containsString(services, service) {
+			scaled = append(scaled, service)
+		}
+	}
+	sort.Strings(scaled)
+	var args []string
+	for _, service := range scaled {
+		args = append(args, "--scale", fmt.Sprintf("%s=%d", service, scale[service]))
+	}
+	return args
+}
+
+// waitReady waits for the healthchecks and the probes of the given services, or of every service if nil.
+func (c *Compose) waitReady(ctx context.Context, services []string) error {
+	if c.cfg.waitHealthy > 0 {
+		if err := c.waitHealthy(ctx, c.cfg.waitHealthy); err != nil {
+			return err
+		}
+	}
+
+	for _, sp := range c.cfg.probes {
+		if services != nil && !containsString(services, sp.service) {
+			continue
+		}
+		if err := c.WaitFor(ctx, sp.service, sp.policy, sp.probes...); err != nil {
+			return err
 		}
-		c.containers[key] = container
 	}
 	return nil
 }
 
-func findKey(dockerName string, serviceNames map[string]Service) string {
-	for k := range serviceNames {
-		if strings.Contains(dockerName, k) {
-			return k
+// dependencyClosure returns the given services along with every service they depend on, directly or not, sorted by name.
+// It returns nil if no services are given.
+func dependencyClosure(cfg Config, services []string) ([]string, error) {
+	if len(services) == 0 {
+		return nil, nil
+	}
+	seen := make(map[string]bool)
+	var visit func(service string) error
+	visit = func(service string) error {
+		if seen[service] {
+			return nil
+		}
+		svc, ok := cfg.Services[service]
+		if !ok {
+			return fmt.Errorf("compose: no service %s found", service)
 		}
+		seen[service] = true
+		for _, dep := range svc.DependsOn.Services() {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
-	return ""
+	for _, service := range services {
+		if err := visit(service); err != nil {
+			return nil, err
+		}
+	}
+
+	closure := make([]string, 0, len(seen))
+	for service := range seen {
+		closure = append(closure, service)
+	}
+	sort.Strings(closure)
+	return closure, nil
+}
+
+// updateContainers asks the compose project for its containers and maps each of them
+// to its service using the labels docker-compose attaches to the containers.
+func (c *Compose) updateContainers(ctx context.Context) error {
+	// v2 only lists running containers unless asked for all of them, v1 always lists all of them
+	psArgs := []string{"ps", "-q"}
+	if c.cfg.backend == BackendV2 {
+		psArgs = append(psArgs, "-a")
+	}
+	out, err := composeRun(ctx, &c.cfg, psArgs...)
+	if err != nil {
+		return fmt.Errorf("compose: error listing containers: %w", err)
+	}
+
+	// docker compose may interleave warnings with the ids, so only keep the lines that look like ids
+	var ids []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); containerIDRegexp.MatchString(line) {
+			ids = append(ids, line)
+		}
+	}
+
+	containers := make(map[string][]*ContainerInfo, len(ids))
+	known := ids[:0]
+	for _, id := range ids {
+		container, err := inspect(ctx, c.cfg.executor, id)
+		if err != nil {
+			return err
+		}
+		key := container.ComposeService()
+		// orphans of services removed from the compose file are still part of the project, but not of this Compose
+		if _, ok := c.publicCfg.Services[key]; !ok {
+			c.logger.Printf("ignoring container %s with service label '%s', which is not in the list of services", container.Name, key)
+			continue
+		}
+		known = append(known, id)
+		containers[key] = append(containers[key], container)
+	}
+	// keep the replicas in a stable order, by the number docker compose gives them
+	for _, replicas := range containers {
+		sort.SliceStable(replicas, func(i, j int) bool {
+			return replicas[i].ComposeNumber() < replicas[j].ComposeNumber()
+		})
+	}
+
+	c.ids = known
+	c.containers = containers
+	return nil
 }
 
 // MustStart is like Start, but panics on error.
@@ -281,35 +603,85 @@ func MustStart(opts ...Option) *Compose {
 	return compose
 }
 
+// Config returns the configuration the project was started with, after interpolating its variables.
+func (c *Compose) Config() Config {
+	return c.publicCfg
+}
+
+// GetContainer returns the first container of the service, as reported by `docker inspect`.
 func (c *Compose) GetContainer(key string) (*ContainerInfo, error) {
-	if err := c.updateContainers(); err != nil {
+	containers, err := c.GetContainers(key)
+	if err != nil {
 		return nil, err
 	}
-	i, ok := c.containers[key]
-	if !ok {
+	return containers[0], nil
+}
+
+// GetContainers returns every container of the service, ordered by their replica number.
+func (c *Compose) GetContainers(key string) ([]*ContainerInfo, error) {
+	return c.getContainers(context.Background(), key)
+}
+
+func (c *Compose) getContainers(ctx context.Context, key string) ([]*ContainerInfo, error) {
+	if err := c.updateContainers(ctx); err != nil {
+		return nil, err
+	}
+	containers, ok := c.containers[key]
+	if !ok || len(containers) == 0 {
 		return nil, fmt.Errorf("no container %s found", key)
 	}
-	return i, nil
+	return containers, nil
 }
 
 // Cleanup will try and kill then remove any running containers for the current configuration.
 func (c *Compose) Cleanup() error {
+	return c.CleanupContext(context.Background())
+}
+
+// CleanupContext is like Cleanup, but gives up on stopping and removing the containers once ctx is done.
+func (c *Compose) CleanupContext(ctx context.Context) error {
+	// the followers are stopped with a grace period once the containers stopped, this stops them when stopping fails
+	defer c.stopFollowingLogs(0)
 	if !c.cfg.preventStop {
-		if err := composeStop(c.fileName, c.projectName); err != nil {
+		if err := composeStop(ctx, &c.cfg); err != nil {
 			return err
 		}
+		c.stopFollowingLogs(logFollowerGrace)
 	}
+	c.stopFollowingLogs(0)
 	if c.cfg.keeparound {
+		c.cancelReaper()
 		return nil
 	}
 
 	c.logger.Println("removing stale containers, images, volumes, and networks...")
-	// cleaning based on docker network normalization, which lowercases everything
-	// and strips out all underscores
-	//netName := c.projectName + "_default"
-	return combineErr(composeKill(c.fileName, c.projectName),
-		composeDown(c.fileName, c.projectName),
-		dockerPrune())
+	errs := []error{
+		c.detachSelf(ctx),
+		composeKill(ctx, &c.cfg),
+		composeDown(ctx, &c.cfg),
+		composeRMNetworks(ctx, &c.cfg),
+		composeRMVolumes(ctx, &c.cfg, c.publicCfg.Volumes),
+	}
+	if c.cfg.pruneVolumes {
+		errs = append(errs, dockerPrune(ctx, &c.cfg))
+	}
+	err := combineErr(errs...)
+	if err != nil && ctx.Err() != nil {
+		// combineErr flattens the messages, so keep ctx.Err() inspectable for callers
+		return fmt.Errorf("%v: %w", err, ctx.Err())
+	}
+	if err == nil {
+		c.cancelReaper()
+	}
+	return err
+}
+
+// cancelReaper stops the reaper, if any, without having it remove the project.
+func (c *Compose) cancelReaper() {
+	if c.reaper != nil {
+		c.reaper.cancel()
+		c.reaper = nil
+	}
 }
 
 // MustCleanup is like Cleanup, but panics on error.
@@ -319,13 +691,21 @@ func (c *Compose) MustCleanup() {
 	}
 }
 
-// Connect
+// Connect calls connectFunc until it succeeds or the policy gives up retrying.
 func (c *Compose) Connect(policy RetryPolicy, connectFunc func() error) error {
+	return c.ConnectContext(context.Background(), policy, connectFunc)
+}
+
+// ConnectContext is like Connect, but stops retrying once ctx is done.
+func (c *Compose) ConnectContext(ctx context.Context, policy RetryPolicy, connectFunc func() error) error {
 	var err error
 	var tryAgain bool
 	var wait time.Duration
 
 	for {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fmt.Errorf("compose: connect aborted: %w", ctxErr)
+		}
 		err = connectFunc()
 		if err == nil {
 			return nil
@@ -336,35 +716,39 @@ func (c *Compose) Connect(policy RetryPolicy, connectFunc func() error) error {
 			return err
 		}
 		c.logger.Printf("connect failed, retrying in %d second(s): %v\n", int64(wait.Seconds()), err)
-		time.Sleep(wait)
-
+		if ctxErr := sleepContext(ctx, wait); ctxErr != nil {
+			return fmt.Errorf("compose: connect aborted after: %v: %w", err, ctxErr)
+		}
 	}
 }
 
-func runCmd(name string, args ...string) (string, error) {
-	var outBuf bytes.Buffer
-
-	cmd := exec.Command(name, args...)
-	cmd.Stdout = &outBuf
-	cmd.Stderr = &outBuf
-	// We need to prevent ctrl-c in the parent process from
-	// prematurely killing the docker command
-	// See https://stackoverflow.com/a/33171307/1403990
-	AssignProcAttr(cmd)
+// runCmd runs the command with the given executor, returning its stdout.
+func runCmd(ctx context.Context, e Executor, name string, args ...string) (string, error) {
+	var outBuf, errBuf bytes.Buffer
 
-	cmdErr := cmd.Run()
+	cmdErr := e.Execute(ctx, Command{
+		Name:   name,
+		Args:   args,
+		Stdout: &outBuf,
+		Stderr: &errBuf,
+	})
 	out := outBuf.String()
 	if cmdErr == nil {
 		return out, nil
 	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return out, fmt.Errorf("failed running %s %v: %w", name, args, ctxErr)
+	}
 	err := fmt.Errorf("failed running %s %v: %s", name, args, cmdErr)
 
 	// the output from docker is very noisy, therefore to aide in diagnosing
 	// the errors we only show the log lines which containing meaningful error messages
-	scanner := bufio.NewScanner(bytes.NewReader(outBuf.Bytes()))
+	combined := errBuf.String() + out
+	scanner := bufio.NewScanner(strings.NewReader(combined))
 	errCount := 0
 	for scanner.Scan() {
-		if strings.HasPrefix(scanner.Text(), "ERROR:") ||
+		// v1 prefixes its errors with "ERROR:", v2 with "Error response from daemon:" or "error ..."
+		if strings.HasPrefix(strings.ToLower(scanner.Text()), "error") ||
 			strings.HasPrefix(scanner.Text(), "compose.cli.errors") {
 			errCount++
 			err = combineErr(err, errors.New(scanner.Text()))
@@ -374,78 +758,161 @@ func runCmd(name string, args ...string) (string, error) {
 		err = combineErr(err, fmt.Errorf("could not output error lines: %s", errScan))
 	}
 	if errCount == 0 {
-		err = combineErr(err, errors.New(out))
+		err = combineErr(err, errors.New(combined))
 	}
 
 	return out, err
 }
 
-func composeKill(fName string, pName string) error {
-	_, err := composeRun(fName, pName, "kill")
+func composeKill(ctx context.Context, cfg *internalCFG) error {
+	_, err := composeRun(ctx, cfg, "kill")
 	if err != nil {
-		return fmt.Errorf("compose: error killing stale containers: %v", err)
+		return fmt.Errorf("compose: error killing stale containers: %w", err)
 	}
 	return err
 }
 
-func composeRm(fName string, pName string) error {
-	out, err := composeRun(fName, pName, "rm", "--force", "-v")
+func composeRm(ctx context.Context, cfg *internalCFG) error {
+	out, err := composeRun(ctx, cfg, "rm", "--force", "-v")
 	if err != nil {
-		return fmt.Errorf("compose: error removing stale containers: %s, %v", out, err)
+		return fmt.Errorf("compose: error removing stale containers: %s, %w", out, err)
 	}
 	return nil
 }
 
-func composeStop(fName string, pName string) error {
-	out, err := composeRun(fName, pName, "stop")
+func composeStop(ctx context.Context, cfg *internalCFG) error {
+	out, err := composeRun(ctx, cfg, "stop")
 	if err != nil {
-		return fmt.Errorf("compose: error stopping stale containers: %s, %v", out, err)
+		return fmt.Errorf("compose: error stopping stale containers: %s, %w", out, err)
 	}
 	return nil
 }
 
-func composeDown(fName string, pName string) error {
-	out, err := composeRun(fName, pName, "down", "-v", "--remove-orphans")
+func composeDown(ctx context.Context, cfg *internalCFG) error {
+	out, err := composeRun(ctx, cfg, "down", "-v", "--remove-orphans")
 	if err != nil {
-		return fmt.Errorf("compose: error downing stale containers: %s, %v", out, err)
+		return fmt.Errorf("compose: error downing stale containers: %s, %w", out, err)
 	}
 	return nil
 }
 
-func composeRMNetwork(netName string) error {
-	var out string
-	err := connect(3, time.Second*2, func() error {
-		o, err := dockerRun("network", "rm", netName)
-		out = o
+// composeRMNetworks removes the networks labeled for the project which down left behind,
+// for example because a container was still attached. External networks are never labeled for the project.
+func composeRMNetworks(ctx context.Context, cfg *internalCFG) error {
+	out, err := dockerRun(ctx, cfg, "network", "ls", "-q", "--filter", "label="+labelProject+"="+cfg.projectName)
+	if err != nil {
+		return fmt.Errorf("compose: error listing networks of project %s: %w", cfg.projectName, err)
+	}
+	ids := strings.Fields(out)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var rmOut string
+	err = connect(ctx, 3, time.Second*2, func() error {
+		o, err := dockerRun(ctx, cfg, append([]string{"network", "rm"}, ids...)...)
+		rmOut = o
 		return err
 	})
+	if err != nil {
+		return fmt.Errorf("compose: error removing networks of project %s: %s, %w", cfg.projectName, rmOut, err)
+	}
+	return nil
+}
+
+// composeRMVolumes removes the volumes labeled for the project, as well as the declared volumes
+// which docker compose created without labels. External volumes are left alone.
+func composeRMVolumes(ctx context.Context, cfg *internalCFG, declared map[string]interface{}) error {
+	out, err := dockerRun(ctx, cfg, "volume", "ls", "-q", "--filter", "label="+labelProject+"="+cfg.projectName)
+	if err != nil {
+		return fmt.Errorf("compose: error listing project volumes: %w", err)
+	}
+	names := strings.Fields(out)
+
+	if wanted := declaredVolumeNames(cfg.projectName, declared); len(wanted) > 0 {
+		out, err := dockerRun(ctx, cfg, "volume", "ls", "-q")
+		if err != nil {
+			return fmt.Errorf("compose: error listing volumes: %w", err)
+		}
+		for _, name := range strings.Fields(out) {
+			if wanted[name] {
+				names = appendUnique(names, name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
 
+	var rmOut string
+	err = connect(ctx, 3, time.Second*2, func() error {
+		o, err := dockerRun(ctx, cfg, append([]string{"volume", "rm", "-f"}, names...)...)
+		rmOut = o
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("compose: error removing network %s: %s, %v", netName, out, err)
+		return fmt.Errorf("compose: error removing volumes %v: %s, %w", names, rmOut, err)
 	}
 	return nil
 }
 
-func dockerPrune() error {
+// declaredVolumeNames returns the names docker compose gives to the non external volumes of the configuration.
+func declaredVolumeNames(projectName string, declared map[string]interface{}) map[string]bool {
+	names := make(map[string]bool, len(declared))
+	for key, v := range declared {
+		name := projectName + "_" + key
+		// volumes parsed from yaml come as map[interface{}]interface{}, the ones declared in Go usually don't
+		var external, customName interface{}
+		switch opts := v.(type) {
+		case map[interface{}]interface{}:
+			external, customName = opts["external"], opts["name"]
+		case map[string]interface{}:
+			external, customName = opts["external"], opts["name"]
+		}
+		if b, ok := external.(bool); ok && b || external != nil && !ok {
+			continue
+		}
+		if n, ok := customName.(string); ok && n != "" {
+			name = n
+		}
+		names[name] = true
+	}
+	return names
+}
+
+func appendUnique(list []string, s string) []string {
+	if containsString(list, s) {
+		return list
+	}
+	return append(list, s)
+}
+
+func dockerPrune(ctx context.Context, cfg *internalCFG) error {
 	var out string
-	err := connect(3, time.Second*2, func() error {
-		o, err := dockerRun("volume", "prune", "-f")
+	err := connect(ctx, 3, time.Second*2, func() error {
+		o, err := dockerRun(ctx, cfg, "volume", "prune", "-f")
 		out = o
 		return err
 	})
 
 	if err != nil {
-		return fmt.Errorf("compose: error system prune: %s, %v", out, err)
+		return fmt.Errorf("compose: error system prune: %s, %w", out, err)
 	}
 	return nil
 }
 
-func composeRun(fName string, projectName string, otherArgs ...string) (string, error) {
-	args := []string{"-f", fName, "-p", projectName}
-	args = append(args, otherArgs...)
-	return runCmd("docker-compose", args...)
+func composeRun(ctx context.Context, cfg *internalCFG, otherArgs ...string) (string, error) {
+	name, args := composeArgs(cfg, otherArgs...)
+	return runCmd(ctx, cfg.executor, name, args...)
+}
+
+// composeArgs returns the program and the arguments to run a docker compose command for the project.
+func composeArgs(cfg *internalCFG, otherArgs ...string) (string, []string) {
+	name, args := cfg.backend.command()
+	args = append(args, "-f", cfg.outFile, "-p", cfg.projectName)
+	return name, append(args, otherArgs...)
 }
 
-func dockerRun(cmdAndArgs ...string) (string, error) {
-	return runCmd("docker", cmdAndArgs...)
+func dockerRun(ctx context.Context, cfg *internalCFG, cmdAndArgs ...string) (string, error) {
+	return runCmd(ctx, cfg.executor, "docker", cmdAndArgs...)
 }
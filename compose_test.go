@@ -1,22 +1,34 @@
 package dccli
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/gocql/gocql"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net"
 	"net/http"
-	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
 )
 
+// dockerHostURL returns the URL of a port published on the Docker host.
+func dockerHostURL(port uint32) string {
+	return "http://" + net.JoinHostPort(MustInferDockerHost(), strconv.FormatUint(uint64(port), 10))
+}
+
 var cfg = Config{
 	Version: "3",
 	Services: map[string]Service{
 		"mysql": {
 			Image: "mysql:5.7",
-			Ports: []string{"3306"},
+			Ports: []ServicePort{{Target: 3306}},
 			Environment: []string{
 				"MYSQL_ROOT_PASSWORD=root",
 				"MYSQL_DATABASE=test",
@@ -24,7 +36,7 @@ var cfg = Config{
 		},
 		"ms": {
 			Image: "ubuntu:trusty",
-			Ports: []string{"3000", "1090"},
+			Ports: []ServicePort{{Target: 3000}, {Target: 1090}},
 			Command: []string{"python3", "-c", `import sys
 from http.server import BaseHTTPRequestHandler, HTTPServer
 PORT = 3000
@@ -53,39 +65,87 @@ func TestGoodYML(t *testing.T) {
 		OptionForcePull(false), OptionRMFirst(false))
 	defer c.MustCleanup()
 	require.NotNil(t, c.containers)
-	if c.containers["ms"].Name != "/testgoodyml_ms_1" {
-		t.Errorf("found name '%v', expected '/ms", c.containers["ms"].Name)
+	if expected := expectedContainerName(c, "ms"); c.containers["ms"][0].Name != expected {
+		t.Errorf("found name '%v', expected '%v'", c.containers["ms"][0].Name, expected)
 	}
-	if c.containers["mysql"].Name != "/testgoodyml_mysql_1" {
-		t.Errorf("found name '%v', expected '/mysql", c.containers["mysql"].Name)
+	if expected := expectedContainerName(c, "mysql"); c.containers["mysql"][0].Name != expected {
+		t.Errorf("found name '%v', expected '%v'", c.containers["mysql"][0].Name, expected)
 	}
 	//if port := compose.Containers["ms"].MustGetFirstPublicPort(3000, "tcp"); port != 10000 {
 	//	t.Fatalf("found port %v, expected 10000", port)
 	//}
 }
 
+// expectedContainerName returns the name the backend in use gives to the first container of a service.
+func expectedContainerName(c *Compose, service string) string {
+	if c.cfg.backend == BackendV2 {
+		return fmt.Sprintf("/%s-%s-1", c.projectName, service)
+	}
+	return fmt.Sprintf("/%s_%s_1", c.projectName, service)
+}
+
+func TestNormalizeProjectName(t *testing.T) {
+	for _, tc := range []struct {
+		backend    Backend
+		name, want string
+	}{
+		// v1 drops dashes and underscores too, even though docker-compose 1.21 and later would keep them
+		{BackendV1, "Test_With_UnderscoreNamedTest", "testwithunderscorenamedtest"},
+		{BackendV1, "My-Project", "myproject"},
+		{BackendV1, "my.project", "myproject"},
+		{BackendV1, "api-v1.2_test", "apiv12test"},
+		{BackendV2, "Test_With_UnderscoreNamedTest", "test_with_underscorenamedtest"},
+		{BackendV2, "My-Project", "my-project"},
+		{BackendV2, "my.project", "myproject"},
+		{BackendV2, "_Project_1", "project_1"},
+	} {
+		require.Equal(t, tc.want, normalizeProjectName(tc.backend, tc.name), "%v %s", tc.backend, tc.name)
+	}
+}
+
+func TestBackendV2(t *testing.T) {
+	c := MustStart(OptionWithCompose(cfg),
+		OptionWithProjectName(t.Name()),
+		OptionBackend(BackendV2))
+	defer c.MustCleanup()
+	require.NotNil(t, c.containers["ms"])
+	require.Equal(t, "/testbackendv2-ms-1", c.containers["ms"][0].Name)
+}
+
 func TestRestart(t *testing.T) {
 	TestGoodYML(t)
 }
 
 func TestBadYML(t *testing.T) {
-	t.Skip("figure out a how to create a bad config")
-	c, err := Start(OptionForcePull(true), OptionRMFirst(true))
+	notInContainer(t)
+	localDocker(t)
+	bad := Config{Services: map[string]Service{
+		"ms": {Image: "ubuntu:trusty", Ports: []ServicePort{{Target: 3000, Published: "http"}}, DependsOn: ServiceDependencies{"db": {}}},
+	}}
+	// validation fails before any command is run
+	e := NewReplayExecutor()
+	c, err := Start(OptionWithCompose(bad), OptionWithLogger(quietLogger),
+		OptionBackend(BackendV1), OptionWithExecutor(e),
+		OptionForcePull(true), OptionRMFirst(true))
 	if err == nil {
 		defer c.MustCleanup()
-		t.Error("expected error")
+		t.Fatal("expected error")
 	}
+	var errs ValidationErrors
+	require.True(t, errors.As(err, &errs))
+	require.Len(t, errs, 2)
+	require.Equal(t, ValidationError{Service: "ms", Field: "depends_on.db", Reason: "no service db found"}, errs[1])
+	require.Empty(t, e.Calls())
 }
 
 func TestMustInferDockerHost(t *testing.T) {
-	envHost := os.Getenv("DOCKER_HOST")
-	defer os.Setenv("DOCKER_HOST", envHost)
+	notInContainer(t)
+	localDocker(t)
 
-	os.Setenv("DOCKER_HOST", "")
 	if host := MustInferDockerHost(); host != "127.0.0.1" {
 		t.Errorf("found '%v', expected '127.0.0.1'", host)
 	}
-	os.Setenv("DOCKER_HOST", "tcp://192.168.99.100:2376")
+	setEnv(t, "DOCKER_HOST", "tcp://192.168.99.100:2376")
 	if host := MustInferDockerHost(); host != "192.168.99.100" {
 		t.Errorf("found '%v', expected '192.168.99.100'", host)
 	}
@@ -97,7 +157,7 @@ func TestMustConnectWithDefaults(t *testing.T) {
 	defer c.MustCleanup()
 	require.NotNil(t, c.containers)
 	require.NotNil(t, c.containers["ms"])
-	mockServerURL := fmt.Sprintf("http://%v:%v", MustInferDockerHost(), c.containers["ms"].MustGetFirstPublicPort(3000, "tcp"))
+	mockServerURL := dockerHostURL(c.containers["ms"][0].MustGetFirstPublicPort(3000, "tcp"))
 	err := c.Connect(NewSimpleRetryPolicy(3, time.Second), func() error {
 		defaultLogger.Print("attempting to connect to mockserver...", mockServerURL)
 		_, err := http.Get(mockServerURL)
@@ -109,12 +169,22 @@ func TestMustConnectWithDefaults(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestStartWaitsForProbes(t *testing.T) {
+	c := MustStart(OptionWithCompose(cfg),
+		OptionWaitFor("ms", nil, TCPProbe{Port: 3000}, HTTPProbe{Port: 3000, Body: regexp.MustCompile("Hello world!")}),
+		OptionWaitFor("mysql", NewSimpleRetryPolicy(30, time.Second), LogProbe{Pattern: regexp.MustCompile("ready for connections")}))
+	defer c.MustCleanup()
+
+	_, err := http.Get(dockerHostURL(c.containers["ms"][0].MustGetFirstPublicPort(3000, "tcp")))
+	require.NoError(t, err)
+}
+
 func TestPolicyBadConnect(t *testing.T) {
 	c := MustStart(OptionWithCompose(cfg))
 	defer c.MustCleanup()
 
 	//mockServerURL := fmt.Sprintf("http://%v:%v", MustInferDockerHost(), c.Containers["ms"].MustGetFirstPublicPort(3000, "tcp"))
-	badMockServerURL := fmt.Sprintf("http://%v/:%v", MustInferDockerHost(), c.containers["ms"].MustGetFirstPublicPort(1090, "tcp"))
+	badMockServerURL := fmt.Sprintf("http://%v/:%v", MustInferDockerHost(), c.containers["ms"][0].MustGetFirstPublicPort(1090, "tcp"))
 
 	retries := 3
 	actualTries := 0
@@ -142,6 +212,246 @@ func TestPolicyBadConnect(t *testing.T) {
 	}
 }
 
+func TestConnectContextCancelled(t *testing.T) {
+	c := &Compose{logger: defaultLogger}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	tries := 0
+	err := c.ConnectContext(ctx, NewSimpleRetryPolicy(10, time.Minute), func() error {
+		tries++
+		return errors.New("not yet")
+	})
+	require.Error(t, err)
+	require.True(t, errors.Is(err, context.DeadlineExceeded), "expected deadline error, got: %v", err)
+	require.Equal(t, 1, tries)
+	require.True(t, time.Since(start) < time.Minute)
+}
+
+func healthResponses(msState string) []RecordedCommand {
+	return []RecordedCommand{
+		{Args: composeCmd("ps", "-q"), Stdout: msID + "\n" + mysqlID + "\n"},
+		{Args: []string{"docker", "inspect", msID}, Stdout: inspectOutputWithState(msID, "dccli_ms_1", "ms", msState)},
+		{Args: []string{"docker", "inspect", mysqlID}, Stdout: inspectOutput(mysqlID, "dccli_mysql_1", "mysql")},
+	}
+}
+
+func TestWaitHealthy(t *testing.T) {
+	notInContainer(t)
+	localDocker(t)
+	responses := startResponses()
+	responses = append(responses, healthResponses(`{"Running": true, "Health": {"Status": "starting"}}`)...)
+	responses = append(responses, healthResponses(`{"Running": true, "Health": {"Status": "healthy"}}`)...)
+	e := NewReplayExecutor(responses...)
+
+	c, err := Start(OptionWithCompose(cfg),
+		OptionWithLogger(quietLogger),
+		OptionBackend(BackendV1),
+		OptionWithExecutor(e),
+		OptionWaitHealthy(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, HealthHealthy, c.containers["ms"][0].State.Health.Status)
+	require.Empty(t, e.Pending())
+}
+
+func TestWaitHealthyUnhealthy(t *testing.T) {
+	notInContainer(t)
+	localDocker(t)
+	responses := startResponses()
+	responses = append(responses, healthResponses(`{"Running": true, "Health": {"Status": "unhealthy", "FailingStreak": 3,
+		"Log": [{"ExitCode": 1, "Output": "first"}, {"ExitCode": 1, "Output": "connection refused\n"}]}}`)...)
+	responses = append(responses, cleanupResponses()...)
+	e := NewReplayExecutor(responses...)
+
+	_, err := Start(OptionWithCompose(cfg),
+		OptionWithLogger(quietLogger),
+		OptionBackend(BackendV1),
+		OptionWithExecutor(e),
+		OptionWaitHealthy(time.Minute))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "service ms is unhealthy")
+	require.Contains(t, err.Error(), "healthcheck exited with 1: connection refused")
+	require.Empty(t, e.Pending(), "the containers are cleaned up")
+}
+
+func TestWaitHealthyExited(t *testing.T) {
+	notInContainer(t)
+	localDocker(t)
+	responses := startResponses()
+	responses = append(responses, healthResponses(`{"Running": false, "ExitCode": 137, "Health": {"Status": "starting"}}`)...)
+	responses = append(responses, cleanupResponses()...)
+	e := NewReplayExecutor(responses...)
+
+	_, err := Start(OptionWithCompose(cfg),
+		OptionWithLogger(quietLogger),
+		OptionBackend(BackendV1),
+		OptionWithExecutor(e),
+		OptionWaitHealthy(time.Minute))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "service ms exited with code 137")
+	require.Empty(t, e.Pending(), "the containers are cleaned up")
+}
+
+func TestCleanupScopesVolumes(t *testing.T) {
+	e := NewReplayExecutor(
+		RecordedCommand{Args: composeCmd("stop")},
+		RecordedCommand{Args: composeCmd("kill")},
+		RecordedCommand{Args: composeCmd("down", "-v", "--remove-orphans")},
+		RecordedCommand{Args: []string{"docker", "network", "ls", "-q", "--filter", "label=com.docker.compose.project=dccli"}},
+		RecordedCommand{Args: []string{"docker", "volume", "ls", "-q", "--filter", "label=com.docker.compose.project=dccli"},
+			Stdout: "dccli_data\n"},
+		RecordedCommand{Args: []string{"docker", "volume", "ls", "-q"},
+			Stdout: "dccli_data\ndccli_legacy\nshared\nother_data\n"},
+		RecordedCommand{Args: []string{"docker", "volume", "rm", "-f", "dccli_data", "dccli_legacy"}},
+		RecordedCommand{Args: []string{"docker", "volume", "prune", "-f"}},
+	)
+	c := &Compose{
+		logger: quietLogger,
+		publicCfg: Config{Volumes: map[string]interface{}{
+			"data":   nil,
+			"legacy": map[interface{}]interface{}{},
+			"shared": map[string]interface{}{"external": true},
+		}},
+		cfg: internalCFG{outFile: "docker-compose.yaml", projectName: "dccli", backend: BackendV1, executor: e, pruneVolumes: true},
+	}
+
+	require.NoError(t, c.Cleanup())
+	require.Empty(t, e.Pending())
+}
+
+func replicaInspectOutput(id, service string, n int) string {
+	return fmt.Sprintf(`[{
+  "Id": %q,
+  "Name": "/dccli_%s_%d",
+  "Config": {"Labels": {"com.docker.compose.service": %q, "com.docker.compose.container-number": "%d"}},
+  "NetworkSettings": {"Ports": {"3000/tcp": [{"HostPort": "3276%d"}]}}
+}]`, id, service, n, service, n, n)
+}
+
+func TestScale(t *testing.T) {
+	notInContainer(t)
+	localDocker(t)
+	ms2ID := "1111111111111111111111111111111111111111111111111111111111111111"
+	e := NewReplayExecutor(
+		RecordedCommand{Args: composeCmd("up", "-d", "--scale", "ms=2", "--scale", "mysql=0")},
+		RecordedCommand{Args: composeCmd("ps", "-q"), Stdout: ms2ID + "\n" + msID + "\n"},
+		RecordedCommand{Args: []string{"docker", "inspect", ms2ID}, Stdout: replicaInspectOutput(ms2ID, "ms", 2)},
+		RecordedCommand{Args: []string{"docker", "inspect", msID}, Stdout: replicaInspectOutput(msID, "ms", 1)},
+	)
+
+	c, err := Start(OptionWithCompose(cfg),
+		OptionWithLogger(quietLogger),
+		OptionBackend(BackendV1),
+		OptionWithExecutor(e),
+		OptionScale("ms", 2),
+		OptionScale("mysql", 0))
+	require.NoError(t, err)
+	require.Empty(t, e.Pending())
+
+	require.Len(t, c.containers["ms"], 2)
+	require.Equal(t, msID, c.containers["ms"][0].ID)
+	require.Equal(t, uint32(32761), c.containers["ms"][0].MustGetFirstPublicPort(3000, "tcp"))
+	require.Equal(t, ms2ID, c.containers["ms"][1].ID)
+	require.Equal(t, uint32(32762), c.containers["ms"][1].MustGetFirstPublicPort(3000, "tcp"))
+}
+
+func TestStartSubsetAndUp(t *testing.T) {
+	notInContainer(t)
+	localDocker(t)
+	subsetCFG := Config{
+		Version: "3",
+		Services: map[string]Service{
+			"web":   {Image: "nginx", DependsOn: ServiceDependencies{"api": {}}},
+			"api":   {Image: "api", DependsOn: ServiceDependencies{"db": {}}},
+			"db":    {Image: "postgres"},
+			"cache": {Image: "redis"},
+		},
+	}
+	e := NewReplayExecutor(
+		RecordedCommand{Args: composeCmd("up", "-d", "--scale", "db=2", "api", "db")},
+		RecordedCommand{Args: composeCmd("ps", "-q"), Stdout: msID + "\n" + mysqlID + "\n"},
+		RecordedCommand{Args: []string{"docker", "inspect", msID}, Stdout: inspectOutput(msID, "dccli_api_1", "api")},
+		RecordedCommand{Args: []string{"docker", "inspect", mysqlID}, Stdout: inspectOutput(mysqlID, "dccli_db_1", "db")},
+		RecordedCommand{Args: composeCmd("up", "-d", "--scale", "cache=3", "cache")},
+		RecordedCommand{Args: composeCmd("ps", "-q"), Stdout: msID + "\n"},
+		RecordedCommand{Args: []string{"docker", "inspect", msID}, Stdout: inspectOutput(msID, "dccli_cache_1", "cache")},
+	)
+
+	c, err := Start(OptionWithCompose(subsetCFG),
+		OptionWithLogger(quietLogger),
+		OptionBackend(BackendV1),
+		OptionWithExecutor(e),
+		OptionServices("api"),
+		OptionScale("db", 2),
+		OptionScale("cache", 3),
+		OptionWaitFor("web", nil, ProbeFunc(func(ctx context.Context, c *Compose, service string) error {
+			return errors.New("web is not started, so it should not be probed")
+		})))
+	require.NoError(t, err)
+	require.Len(t, c.containers, 2)
+
+	require.NoError(t, c.Up("cache"))
+	require.Contains(t, c.containers, "cache")
+	require.Empty(t, e.Pending())
+
+	require.Error(t, c.Up("nope"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.True(t, errors.Is(c.UpContext(ctx, "cache"), context.Canceled))
+}
+
+func TestStartKeepsNetworks(t *testing.T) {
+	notInContainer(t)
+	localDocker(t)
+	netCFG := Config{
+		Version:  "3",
+		Networks: map[string]*Network{"backend": {Internal: true}},
+		Services: map[string]Service{
+			"ms":    {Image: "ubuntu:trusty", Networks: ServiceNetworks{"backend": {Aliases: []string{"api"}}}},
+			"mysql": {Image: "mysql:5.7", Networks: ServiceNetworks{"backend": nil, "default": nil}},
+		},
+	}
+	out := filepath.Join(t.TempDir(), "docker-compose.yaml")
+	e := NewReplayExecutor(startResponses()...)
+
+	_, err := Start(OptionWithCompose(netCFG),
+		OptionWithLogger(quietLogger),
+		OptionBackend(BackendV1),
+		OptionWithExecutor(e),
+		OptionWriteToFile(out))
+	require.NoError(t, err)
+
+	bs, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	var written Config
+	require.NoError(t, yaml.Unmarshal(bs, &written))
+	require.Equal(t, netCFG.Networks, written.Networks)
+	require.Equal(t, netCFG.Services["ms"].Networks, written.Services["ms"].Networks)
+	require.Equal(t, netCFG.Services["mysql"].Networks, written.Services["mysql"].Networks)
+}
+
+func TestDependencyClosure(t *testing.T) {
+	closureCFG := Config{Services: map[string]Service{
+		"a": {DependsOn: ServiceDependencies{"b": {}, "c": {}}},
+		"b": {DependsOn: ServiceDependencies{"c": {}}},
+		"c": {DependsOn: ServiceDependencies{"a": {}}},
+		"d": {},
+	}}
+	closure, err := dependencyClosure(closureCFG, []string{"b"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b", "c"}, closure)
+
+	closure, err = dependencyClosure(closureCFG, nil)
+	require.NoError(t, err)
+	require.Nil(t, closure)
+
+	_, err = dependencyClosure(closureCFG, []string{"e"})
+	require.Error(t, err)
+}
+
 func TestInspectUnknownContainer(t *testing.T) {
 	_, err := Inspect("bad")
 	if err == nil {
@@ -153,9 +463,9 @@ func TestMustInspect(t *testing.T) {
 	c := MustStart(OptionWithCompose(cfg))
 	defer c.MustCleanup()
 
-	ms := MustInspect(c.containers["ms"].ID)
-	if ms.Name != "/dccli_ms_1" {
-		t.Errorf("found '%v', expected '/dccli_ms_1", ms.Name)
+	ms := MustInspect(c.containers["ms"][0].ID)
+	if expected := expectedContainerName(c, "ms"); ms.Name != expected {
+		t.Errorf("found '%v', expected '%v'", ms.Name, expected)
 	}
 }
 
@@ -171,7 +481,7 @@ func TestGetContainer(t *testing.T) {
 func Test_With_UnderscoreNamedTest(t *testing.T) {
 	c := MustStart(OptionWithCompose(cfg),
 		OptionWithProjectName(t.Name()),
-		OptionWriteToFile("docker-compose-test.yaml"))
+		OptionWriteToFile(filepath.Join(t.TempDir(), "docker-compose-test.yaml")))
 	defer c.MustCleanup()
 }
 
@@ -181,7 +491,7 @@ func TestScyllaDB(t *testing.T) {
 		Services: map[string]Service{
 			"scylla": {
 				Image:   "scylladb/scylla:2.3.1",
-				Ports:   []string{"7000", "7001", "7199", "9042", "9160"},
+				Ports:   []ServicePort{{Target: 7000}, {Target: 7001}, {Target: 7199}, {Target: 9042}, {Target: 9160}},
 				Command: []string{"--smp=1", "--developer-mode=1", "--overprovisioned=1"},
 				Volumes: []*Volume{
 					{
@@ -214,14 +524,18 @@ func TestScyllaDB(t *testing.T) {
 		b.Keyspace = "system"
 		b.DisableInitialHostLookup = true
 		b.Compressor = &gocql.SnappyCompressor{}
-		b.Port = int(c.containers["scylla"].MustGetFirstPublicPort(9042, "tcp"))
+		b.Port = int(c.containers["scylla"][0].MustGetFirstPublicPort(9042, "tcp"))
 
 		_, err := b.CreateSession()
 		return err
 	})
 
 	if err != nil {
-		t.Errorf("should have connected")
+		logs, logErr := c.Logs(context.Background(), "scylla", LogOptions{Tail: 50})
+		require.NoError(t, logErr)
+		defer logs.Close()
+		out, _ := ioutil.ReadAll(logs)
+		t.Errorf("should have connected: %v\nscylla logs:\n%s", err, out)
 	}
 }
 
@@ -234,7 +548,7 @@ func TestParallelMustConnectWithDefaults(t *testing.T) {
 	wg := sync.WaitGroup{}
 	wg.Add(2)
 
-	mockServerURL := fmt.Sprintf("http://%v:%v", MustInferDockerHost(), compose1.containers["ms"].MustGetFirstPublicPort(3000, "tcp"))
+	mockServerURL := dockerHostURL(compose1.containers["ms"][0].MustGetFirstPublicPort(3000, "tcp"))
 
 	go func() {
 		err1 := compose1.Connect(NewSimpleRetryPolicy(3, time.Second), func() error {
@@ -250,7 +564,7 @@ func TestParallelMustConnectWithDefaults(t *testing.T) {
 	}()
 
 	go func() {
-		mockServerURL2 := fmt.Sprintf("http://%v:%v", MustInferDockerHost(), compose2.containers["ms"].MustGetFirstPublicPort(3000, "tcp"))
+		mockServerURL2 := dockerHostURL(compose2.containers["ms"][0].MustGetFirstPublicPort(3000, "tcp"))
 
 		err2 := compose2.Connect(NewSimpleRetryPolicy(3, time.Second), func() error {
 			defaultLogger.Print("attempting to connect to mockserver 2...", mockServerURL2)
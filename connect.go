@@ -1,6 +1,8 @@
 package dccli
 
 import (
+	"context"
+	"fmt"
 	"math"
 	"math/rand"
 	"time"
@@ -13,7 +15,8 @@ const (
 
 // connect attempts to connect to a container using the given connector function.
 // Use retryCount and retryDelay to configure the number of retries and the time waited between them (using exponential backoff).
-func connect(retryCount int, baseRetryDelay time.Duration, connectFunc func() error) error {
+// Retrying stops as soon as ctx is done.
+func connect(ctx context.Context, retryCount int, baseRetryDelay time.Duration, connectFunc func() error) error {
 	var err error
 
 	for i := 0; i < retryCount; i++ {
@@ -21,13 +24,27 @@ func connect(retryCount int, baseRetryDelay time.Duration, connectFunc func() er
 		if err == nil {
 			return nil
 		}
-		time.Sleep(baseRetryDelay)
+		if ctxErr := sleepContext(ctx, baseRetryDelay); ctxErr != nil {
+			return fmt.Errorf("%v: %w", err, ctxErr)
+		}
 		baseRetryDelay *= 2
 	}
 
 	return err
 }
 
+// sleepContext pauses for the given duration, returning early with ctx.Err() once ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
 type RetryPolicy interface {
 	AttemptAgain(error) (bool, time.Duration)
 }
@@ -1,6 +1,7 @@
 package dccli
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -13,38 +14,134 @@ type ContainerInfo struct {
 	ID              string           `json:"Id"`
 	Name            string           `json:"Name,omitempty"`
 	Created         time.Time        `json:"Created,omitempty"`
+	Path            string           `json:"Path,omitempty"`
+	Args            []string         `json:"Args,omitempty"`
 	Config          *ContainerConfig `json:"Config,omitempty"`
 	State           ContainerState   `json:"State,omitempty"`
 	Image           string           `json:"Image,omitempty"`
+	RestartCount    int              `json:"RestartCount,omitempty"`
+	HostConfig      *HostConfig      `json:"HostConfig,omitempty"`
+	Mounts          []MountPoint     `json:"Mounts,omitempty"`
 	NetworkSettings *NetworkSettings `json:"NetworkSettings,omitempty"`
 }
 
 // ContainerConfig models the config section of the `docker inspect` command output.
 type ContainerConfig struct {
 	Hostname     string              `json:"Hostname,omitempty"`
+	User         string              `json:"User,omitempty"`
 	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
 	Env          []string            `json:"Env,omitempty"`
 	Cmd          []string            `json:"Cmd"`
+	Healthcheck  *HealthConfig       `json:"Healthcheck,omitempty"`
 	Image        string              `json:"Image,omitempty"`
+	WorkingDir   string              `json:"WorkingDir,omitempty"`
+	Entrypoint   []string            `json:"Entrypoint,omitempty"`
 	Labels       map[string]string   `json:"Labels,omitempty"`
+	StopSignal   string              `json:"StopSignal,omitempty"`
+}
+
+// HealthConfig models the healthcheck in the config section of the `docker inspect` command output.
+type HealthConfig struct {
+	Test        []string      `json:"Test,omitempty"`
+	Interval    time.Duration `json:"Interval,omitempty"`
+	Timeout     time.Duration `json:"Timeout,omitempty"`
+	StartPeriod time.Duration `json:"StartPeriod,omitempty"`
+	Retries     int           `json:"Retries,omitempty"`
+}
+
+// HostConfig models the host config section of the `docker inspect` command output.
+type HostConfig struct {
+	Binds         []string                 `json:"Binds,omitempty"`
+	NetworkMode   string                   `json:"NetworkMode,omitempty"`
+	PortBindings  map[string][]PortBinding `json:"PortBindings,omitempty"`
+	RestartPolicy ContainerRestartPolicy   `json:"RestartPolicy,omitempty"`
+	AutoRemove    bool                     `json:"AutoRemove,omitempty"`
+	CapAdd        []string                 `json:"CapAdd,omitempty"`
+	CapDrop       []string                 `json:"CapDrop,omitempty"`
+	ExtraHosts    []string                 `json:"ExtraHosts,omitempty"`
+	Privileged    bool                     `json:"Privileged,omitempty"`
+	ShmSize       int64                    `json:"ShmSize,omitempty"`
+	Tmpfs         map[string]string        `json:"Tmpfs,omitempty"`
+	Init          *bool                    `json:"Init,omitempty"`
+	// Memory is the memory limit in bytes, 0 if unlimited.
+	Memory int64 `json:"Memory,omitempty"`
+	// NanoCpus is the CPU limit in units of 10^-9 CPUs, 0 if unlimited.
+	NanoCpus  int64             `json:"NanoCpus,omitempty"`
+	CPUShares int64             `json:"CpuShares,omitempty"`
+	Ulimits   []ContainerUlimit `json:"Ulimits,omitempty"`
+}
+
+// ContainerRestartPolicy models the restart policy in the host config section of the `docker inspect` command output.
+type ContainerRestartPolicy struct {
+	Name              string `json:"Name,omitempty"`
+	MaximumRetryCount int    `json:"MaximumRetryCount,omitempty"`
+}
+
+// ContainerUlimit models a ulimit in the host config section of the `docker inspect` command output.
+type ContainerUlimit struct {
+	Name string `json:"Name,omitempty"`
+	Soft int64  `json:"Soft,omitempty"`
+	Hard int64  `json:"Hard,omitempty"`
+}
+
+// MountPoint models a mount in the mounts section of the `docker inspect` command output.
+type MountPoint struct {
+	Type        string `json:"Type,omitempty"`
+	Name        string `json:"Name,omitempty"`
+	Source      string `json:"Source,omitempty"`
+	Destination string `json:"Destination,omitempty"`
+	Driver      string `json:"Driver,omitempty"`
+	Mode        string `json:"Mode,omitempty"`
+	RW          bool   `json:"RW,omitempty"`
+	Propagation string `json:"Propagation,omitempty"`
 }
 
 // ContainerState models the state section of the `docker inspect` command.
 type ContainerState struct {
-	Running    bool      `json:"Running,omitempty"`
-	Paused     bool      `json:"Paused,omitempty"`
-	Restarting bool      `json:"Restarting,omitempty"`
-	OOMKilled  bool      `json:"OOMKilled,omitempty"`
-	Pid        int       `json:"Pid,omitempty"`
-	ExitCode   int       `json:"ExitCode,omitempty"`
-	Error      string    `json:"Error,omitempty"`
-	StartedAt  time.Time `json:"StartedAt,omitempty"`
-	FinishedAt time.Time `json:"FinishedAt,omitempty"`
+	Running    bool             `json:"Running,omitempty"`
+	Paused     bool             `json:"Paused,omitempty"`
+	Restarting bool             `json:"Restarting,omitempty"`
+	OOMKilled  bool             `json:"OOMKilled,omitempty"`
+	Pid        int              `json:"Pid,omitempty"`
+	ExitCode   int              `json:"ExitCode,omitempty"`
+	Error      string           `json:"Error,omitempty"`
+	StartedAt  time.Time        `json:"StartedAt,omitempty"`
+	FinishedAt time.Time        `json:"FinishedAt,omitempty"`
+	Status     string           `json:"Status,omitempty"`
+	Health     *ContainerHealth `json:"Health,omitempty"`
+}
+
+// ContainerHealth models the health section of the `docker inspect` command, only present for containers with a healthcheck.
+type ContainerHealth struct {
+	Status        string              `json:"Status,omitempty"`
+	FailingStreak int                 `json:"FailingStreak,omitempty"`
+	Log           []HealthCheckResult `json:"Log,omitempty"`
+}
+
+// HealthCheckResult models a single healthcheck run in the health section of the `docker inspect` command.
+type HealthCheckResult struct {
+	Start    time.Time `json:"Start,omitempty"`
+	End      time.Time `json:"End,omitempty"`
+	ExitCode int       `json:"ExitCode,omitempty"`
+	Output   string    `json:"Output,omitempty"`
 }
 
 // NetworkSettings models the network settings section of the `docker inspect` command.
 type NetworkSettings struct {
-	Ports map[string][]PortBinding `json:"Ports,omitempty"`
+	Ports    map[string][]PortBinding     `json:"Ports,omitempty"`
+	Networks map[string]*EndpointSettings `json:"Networks,omitempty"`
+}
+
+// EndpointSettings models the settings of a container on a single network in the network settings section
+// of the `docker inspect` command.
+type EndpointSettings struct {
+	NetworkID         string   `json:"NetworkID,omitempty"`
+	IPAddress         string   `json:"IPAddress,omitempty"`
+	IPPrefixLen       int      `json:"IPPrefixLen,omitempty"`
+	Gateway           string   `json:"Gateway,omitempty"`
+	GlobalIPv6Address string   `json:"GlobalIPv6Address,omitempty"`
+	MacAddress        string   `json:"MacAddress,omitempty"`
+	Aliases           []string `json:"Aliases,omitempty"`
 }
 
 // PortBinding models a port binding in the network settings section of the `docker inspect command.
@@ -55,9 +152,18 @@ type PortBinding struct {
 
 // Inspect inspects a container using the `docker inspect` command and returns a parsed version of its output.
 func Inspect(id string) (*ContainerInfo, error) {
-	out, err := runCmd("docker", "inspect", id)
+	return InspectContext(context.Background(), id)
+}
+
+// InspectContext is like Inspect, but aborts the `docker inspect` command once ctx is done.
+func InspectContext(ctx context.Context, id string) (*ContainerInfo, error) {
+	return inspect(ctx, ExecExecutor{}, id)
+}
+
+func inspect(ctx context.Context, e Executor, id string) (*ContainerInfo, error) {
+	out, err := runCmd(ctx, e, "docker", "inspect", id)
 	if err != nil {
-		return nil, fmt.Errorf("compose: error inspecting container: %s: %v", id, err)
+		return nil, fmt.Errorf("compose: error inspecting container: %s: %w", id, err)
 	}
 
 	var inspect []*ContainerInfo
@@ -108,3 +214,62 @@ func (c *ContainerInfo) MustGetFirstPublicPort(exposedPort uint32, proto string)
 	}
 	return port
 }
+
+// IPOnNetwork returns the IP address of the container on the given network. The name is either the name
+// of the Docker network, or the name of a network in the compose configuration, which docker compose
+// prefixes with the project name.
+func (c *ContainerInfo) IPOnNetwork(name string) (string, error) {
+	if c.NetworkSettings == nil {
+		return "", fmt.Errorf("compose: no network settings for container '%v'", c.Name)
+	}
+	endpoint, ok := c.NetworkSettings.Networks[name]
+	if project := c.ComposeProject(); !ok && project != "" {
+		endpoint, ok = c.NetworkSettings.Networks[project+"_"+name]
+	}
+	if !ok || endpoint == nil || endpoint.IPAddress == "" {
+		return "", fmt.Errorf("compose: container '%v' has no IP address on network %v", c.Name, name)
+	}
+	return endpoint.IPAddress, nil
+}
+
+// EnvMap returns the environment variables of the container as a map.
+func (c *ContainerInfo) EnvMap() map[string]string {
+	env := make(map[string]string)
+	if c.Config == nil {
+		return env
+	}
+	for _, entry := range c.Config.Env {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		} else {
+			env[parts[0]] = ""
+		}
+	}
+	return env
+}
+
+// Label returns the value of the label of the container, empty if it is not set.
+func (c *ContainerInfo) Label(key string) string {
+	if c.Config == nil {
+		return ""
+	}
+	return c.Config.Labels[key]
+}
+
+// ComposeProject returns the name of the docker compose project the container belongs to.
+func (c *ContainerInfo) ComposeProject() string {
+	return c.Label(labelProject)
+}
+
+// ComposeService returns the name of the service the container was created for by docker compose.
+func (c *ContainerInfo) ComposeService() string {
+	return c.Label(labelService)
+}
+
+// ComposeNumber returns the number docker compose gave the container among the replicas of its service,
+// 0 if unknown.
+func (c *ContainerInfo) ComposeNumber() int {
+	n, _ := strconv.Atoi(c.Label(labelNumber))
+	return n
+}
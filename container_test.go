@@ -0,0 +1,135 @@
+package dccli
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+const fullInspectOutput = `{
+  "Id": "0d4f6c7e8a9b",
+  "Created": "2021-03-04T10:11:12.123456789Z",
+  "Path": "docker-entrypoint.sh",
+  "Args": ["postgres"],
+  "State": {
+    "Status": "running",
+    "Running": true,
+    "Pid": 4242,
+    "StartedAt": "2021-03-04T10:11:13Z",
+    "Health": {
+      "Status": "unhealthy",
+      "FailingStreak": 3,
+      "Log": [{"Start": "2021-03-04T10:11:20Z", "End": "2021-03-04T10:11:21Z", "ExitCode": 1, "Output": "no response\n"}]
+    }
+  },
+  "Image": "sha256:abc",
+  "Name": "/dccli_db_2",
+  "RestartCount": 2,
+  "HostConfig": {
+    "Binds": ["/srv/init:/docker-entrypoint-initdb.d:ro"],
+    "NetworkMode": "dccli_default",
+    "PortBindings": {"5432/tcp": [{"HostIp": "", "HostPort": ""}]},
+    "RestartPolicy": {"Name": "on-failure", "MaximumRetryCount": 5},
+    "AutoRemove": false,
+    "CapAdd": ["NET_ADMIN"],
+    "ExtraHosts": ["somehost:10.0.0.1"],
+    "Privileged": false,
+    "ShmSize": 67108864,
+    "Tmpfs": {"/run": ""},
+    "Init": true,
+    "Memory": 536870912,
+    "NanoCpus": 1500000000,
+    "CpuShares": 512,
+    "Ulimits": [{"Name": "nofile", "Soft": 20000, "Hard": 40000}]
+  },
+  "Mounts": [
+    {"Type": "bind", "Source": "/srv/init", "Destination": "/docker-entrypoint-initdb.d", "Mode": "ro", "RW": false, "Propagation": "rprivate"},
+    {"Type": "volume", "Name": "dccli_data", "Source": "/var/lib/docker/volumes/dccli_data/_data", "Destination": "/var/lib/postgresql/data", "Driver": "local", "Mode": "rw", "RW": true}
+  ],
+  "Config": {
+    "Hostname": "0d4f6c7e8a9b",
+    "User": "postgres",
+    "Env": ["POSTGRES_PASSWORD=secret", "PGDATA=/var/lib/postgresql/data", "EMPTY=", "PATH=/usr/bin:/bin"],
+    "Cmd": ["postgres"],
+    "Healthcheck": {"Test": ["CMD-SHELL", "pg_isready"], "Interval": 5000000000, "Timeout": 1000000000, "StartPeriod": 10000000000, "Retries": 3},
+    "Image": "postgres:13",
+    "WorkingDir": "/var/lib/postgresql",
+    "Entrypoint": ["docker-entrypoint.sh"],
+    "Labels": {
+      "com.docker.compose.project": "dccli",
+      "com.docker.compose.service": "db",
+      "com.docker.compose.container-number": "2",
+      "dccli.session": "abc"
+    },
+    "StopSignal": "SIGINT"
+  }
+}`
+
+func TestInspectModel(t *testing.T) {
+	var c ContainerInfo
+	require.NoError(t, json.Unmarshal([]byte(fullInspectOutput), &c))
+
+	require.Equal(t, "docker-entrypoint.sh", c.Path)
+	require.Equal(t, []string{"postgres"}, c.Args)
+	require.Equal(t, 2, c.RestartCount)
+	require.Equal(t, 3, c.State.Health.FailingStreak)
+	require.Equal(t, HealthUnhealthy, c.State.Health.Status)
+
+	initProcess := true
+	require.Equal(t, &HostConfig{
+		Binds:         []string{"/srv/init:/docker-entrypoint-initdb.d:ro"},
+		NetworkMode:   "dccli_default",
+		PortBindings:  map[string][]PortBinding{"5432/tcp": {{}}},
+		RestartPolicy: ContainerRestartPolicy{Name: "on-failure", MaximumRetryCount: 5},
+		CapAdd:        []string{"NET_ADMIN"},
+		ExtraHosts:    []string{"somehost:10.0.0.1"},
+		ShmSize:       64 << 20,
+		Tmpfs:         map[string]string{"/run": ""},
+		Init:          &initProcess,
+		Memory:        512 << 20,
+		NanoCpus:      1500000000,
+		CPUShares:     512,
+		Ulimits:       []ContainerUlimit{{Name: "nofile", Soft: 20000, Hard: 40000}},
+	}, c.HostConfig)
+
+	require.Equal(t, []MountPoint{
+		{Type: "bind", Source: "/srv/init", Destination: "/docker-entrypoint-initdb.d", Mode: "ro", Propagation: "rprivate"},
+		{Type: "volume", Name: "dccli_data", Source: "/var/lib/docker/volumes/dccli_data/_data",
+			Destination: "/var/lib/postgresql/data", Driver: "local", Mode: "rw", RW: true},
+	}, c.Mounts)
+
+	require.Equal(t, "postgres", c.Config.User)
+	require.Equal(t, "/var/lib/postgresql", c.Config.WorkingDir)
+	require.Equal(t, []string{"docker-entrypoint.sh"}, c.Config.Entrypoint)
+	require.Equal(t, "SIGINT", c.Config.StopSignal)
+	require.Equal(t, &HealthConfig{
+		Test:        []string{"CMD-SHELL", "pg_isready"},
+		Interval:    5 * time.Second,
+		Timeout:     time.Second,
+		StartPeriod: 10 * time.Second,
+		Retries:     3,
+	}, c.Config.Healthcheck)
+}
+
+func TestContainerHelpers(t *testing.T) {
+	var c ContainerInfo
+	require.NoError(t, json.Unmarshal([]byte(fullInspectOutput), &c))
+
+	require.Equal(t, map[string]string{
+		"POSTGRES_PASSWORD": "secret",
+		"PGDATA":            "/var/lib/postgresql/data",
+		"EMPTY":             "",
+		"PATH":              "/usr/bin:/bin",
+	}, c.EnvMap())
+	require.Equal(t, "abc", c.Label(LabelSession))
+	require.Equal(t, "", c.Label("missing"))
+	require.Equal(t, "dccli", c.ComposeProject())
+	require.Equal(t, "db", c.ComposeService())
+	require.Equal(t, 2, c.ComposeNumber())
+
+	var empty ContainerInfo
+	require.Empty(t, empty.EnvMap())
+	require.Equal(t, "", empty.ComposeService())
+	require.Equal(t, 0, empty.ComposeNumber())
+}
@@ -0,0 +1,100 @@
+package dccli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CopyTo copies the file or directory at hostPath into the container of the service at containerPath,
+// following the semantics of `docker cp`.
+func (c *Compose) CopyTo(service, hostPath, containerPath string) error {
+	return c.CopyToContext(context.Background(), service, hostPath, containerPath)
+}
+
+// CopyToContext is like CopyTo, but gives up once ctx is done.
+func (c *Compose) CopyToContext(ctx context.Context, service, hostPath, containerPath string) error {
+	containers, err := c.getContainers(ctx, service)
+	if err != nil {
+		return err
+	}
+	if _, err := dockerRun(ctx, &c.cfg, "cp", hostPath, containers[0].ID+":"+containerPath); err != nil {
+		return fmt.Errorf("compose: error copying %s to service %s: %w", hostPath, service, err)
+	}
+	return nil
+}
+
+// CopyFrom copies the file or directory at containerPath out of the container of the service to hostPath,
+// following the semantics of `docker cp`.
+func (c *Compose) CopyFrom(service, containerPath, hostPath string) error {
+	return c.CopyFromContext(context.Background(), service, containerPath, hostPath)
+}
+
+// CopyFromContext is like CopyFrom, but gives up once ctx is done.
+func (c *Compose) CopyFromContext(ctx context.Context, service, containerPath, hostPath string) error {
+	containers, err := c.getContainers(ctx, service)
+	if err != nil {
+		return err
+	}
+	if _, err := dockerRun(ctx, &c.cfg, "cp", containers[0].ID+":"+containerPath, hostPath); err != nil {
+		return fmt.Errorf("compose: error copying %s from service %s: %w", containerPath, service, err)
+	}
+	return nil
+}
+
+// CopyTarTo extracts the tar archive read from r into the directory containerDir of the service container.
+func (c *Compose) CopyTarTo(service, containerDir string, r io.Reader) error {
+	return c.CopyTarToContext(context.Background(), service, containerDir, r)
+}
+
+// CopyTarToContext is like CopyTarTo, but gives up once ctx is done.
+func (c *Compose) CopyTarToContext(ctx context.Context, service, containerDir string, r io.Reader) error {
+	containers, err := c.getContainers(ctx, service)
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	err = c.cfg.executor.Execute(ctx, Command{
+		Name:   "docker",
+		Args:   []string{"cp", "-", containers[0].ID + ":" + containerDir},
+		Stdin:  r,
+		Stderr: &stderr,
+	})
+	if err != nil {
+		return fmt.Errorf("compose: error copying archive to service %s: %w: %s", service, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// CopyTarFrom returns the file or directory at containerPath of the service container as a tar archive.
+// The caller has to close the returned reader.
+func (c *Compose) CopyTarFrom(service, containerPath string) (io.ReadCloser, error) {
+	return c.CopyTarFromContext(context.Background(), service, containerPath)
+}
+
+// CopyTarFromContext is like CopyTarFrom, but stops copying once ctx is done.
+func (c *Compose) CopyTarFromContext(ctx context.Context, service, containerPath string) (io.ReadCloser, error) {
+	containers, err := c.getContainers(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	go func() {
+		var stderr bytes.Buffer
+		err := c.cfg.executor.Execute(ctx, Command{
+			Name:   "docker",
+			Args:   []string{"cp", containers[0].ID + ":" + containerPath, "-"},
+			Stdout: pw,
+			Stderr: &stderr,
+		})
+		if err != nil && ctx.Err() == nil {
+			err = fmt.Errorf("compose: error copying %s from service %s: %v: %s", containerPath, service, err, strings.TrimSpace(stderr.String()))
+		}
+		pw.CloseWithError(err)
+	}()
+	return &cmdReader{PipeReader: pr, cancel: cancel}, nil
+}
@@ -0,0 +1,71 @@
+package dccli
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"testing"
+)
+
+// refreshResponses answers the ps and inspect commands GetContainer uses to refresh the containers.
+func refreshResponses() []RecordedCommand {
+	return []RecordedCommand{
+		{Args: composeCmd("ps", "-q"), Stdout: msID + "\n"},
+		{Args: []string{"docker", "inspect", msID}, Stdout: inspectOutput(msID, "dccli_ms_1", "ms")},
+	}
+}
+
+func TestCopyToAndFrom(t *testing.T) {
+	var responses []RecordedCommand
+	responses = append(responses, refreshResponses()...)
+	responses = append(responses, RecordedCommand{Args: []string{"docker", "cp", "fixtures/seed.sql", msID + ":/docker-entrypoint-initdb.d/"}})
+	responses = append(responses, refreshResponses()...)
+	responses = append(responses, RecordedCommand{Args: []string{"docker", "cp", msID + ":/var/dump.sql", "out/"},
+		Stderr: "Error: No such container:path: " + msID + ":/var/dump.sql\n", ExitCode: 1})
+	e := NewReplayExecutor(responses...)
+	c := replayCompose(t, e)
+
+	require.NoError(t, c.CopyTo("ms", "fixtures/seed.sql", "/docker-entrypoint-initdb.d/"))
+	err := c.CopyFrom("ms", "/var/dump.sql", "out/")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "No such container:path")
+	require.Empty(t, e.Pending())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.True(t, errors.Is(c.CopyToContext(ctx, "ms", "fixtures/seed.sql", "/docker-entrypoint-initdb.d/"), context.Canceled))
+}
+
+func TestCopyTar(t *testing.T) {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "report.txt", Mode: 0644, Size: 2}))
+	_, err := tw.Write([]byte("ok"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	var responses []RecordedCommand
+	responses = append(responses, refreshResponses()...)
+	responses = append(responses, RecordedCommand{Args: []string{"docker", "cp", "-", msID + ":/tmp"}})
+	responses = append(responses, refreshResponses()...)
+	responses = append(responses, RecordedCommand{Args: []string{"docker", "cp", msID + ":/tmp/report.txt", "-"}, Stdout: archive.String()})
+	e := NewReplayExecutor(responses...)
+	c := replayCompose(t, e)
+
+	require.NoError(t, c.CopyTarTo("ms", "/tmp", bytes.NewReader(archive.Bytes())))
+
+	r, err := c.CopyTarFrom("ms", "/tmp/report.txt")
+	require.NoError(t, err)
+	defer r.Close()
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	require.NoError(t, err)
+	require.Equal(t, "report.txt", hdr.Name)
+	content, err := ioutil.ReadAll(tr)
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(content))
+	require.Empty(t, e.Pending())
+}
@@ -0,0 +1,234 @@
+package dccli
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Schemes of a DockerEndpoint.
+const (
+	SchemeUnix  = "unix"
+	SchemeNpipe = "npipe"
+	SchemeTCP   = "tcp"
+	SchemeSSH   = "ssh"
+)
+
+const defaultContext = "default"
+
+// DockerEndpoint describes how the Docker daemon is reached.
+type DockerEndpoint struct {
+	// Scheme is one of SchemeUnix, SchemeNpipe, SchemeTCP or SchemeSSH.
+	Scheme string
+	// Host is the host name or IP of the daemon, without brackets for IPv6 addresses. It is empty for sockets.
+	Host string
+	// Port is the port of the daemon, defaulted for tcp and ssh endpoints. It is empty for sockets.
+	Port string
+	// User is the user to log in as for ssh endpoints.
+	User string
+	// Path is the path of unix sockets and named pipes.
+	Path string
+	// TLS holds the TLS settings of tcp endpoints, nil if TLS is not used.
+	TLS *DockerTLS
+	// Context is the name of the Docker context the endpoint was resolved from, empty if set by DOCKER_HOST.
+	Context string
+}
+
+// DockerTLS holds the TLS settings for a Docker daemon.
+type DockerTLS struct {
+	// Verify is set if the daemon certificate is verified.
+	Verify bool
+	// CAFile, CertFile and KeyFile are the paths of the PEM files, empty if missing.
+	CAFile   string
+	CertFile string
+	KeyFile  string
+}
+
+// Local reports whether the daemon is reached through a local socket or named pipe,
+// so ports it publishes are bound on this host.
+func (e *DockerEndpoint) Local() bool {
+	return e.Scheme == SchemeUnix || e.Scheme == SchemeNpipe
+}
+
+// ParseDockerHost parses a Docker host in the format of the DOCKER_HOST environment variable, e.g.
+// "unix:///var/run/docker.sock", "tcp://[::1]:2376", "ssh://user@host" or "host:2375". TLS settings are not
+// part of the host, so TLS is nil for the parsed endpoint.
+func ParseDockerHost(host string) (*DockerEndpoint, error) {
+	if !strings.Contains(host, "://") {
+		host = "tcp://" + host
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("compose: cannot parse docker host '%v': %v", host, err)
+	}
+
+	e := &DockerEndpoint{Scheme: strings.ToLower(u.Scheme)}
+	switch e.Scheme {
+	case SchemeUnix, SchemeNpipe:
+		e.Path = u.Path
+		if e.Path == "" {
+			return nil, fmt.Errorf("compose: no socket path in docker host '%v'", host)
+		}
+		return e, nil
+	case "http", "https":
+		e.Scheme = SchemeTCP
+		e.Port = "2375"
+		if u.Scheme == "https" {
+			e.Port = "2376"
+		}
+	case SchemeTCP:
+		e.Port = "2375"
+	case SchemeSSH:
+		e.Port = "22"
+		if u.User != nil {
+			e.User = u.User.Username()
+		}
+	default:
+		return nil, fmt.Errorf("compose: unsupported scheme %q in docker host '%v'", u.Scheme, host)
+	}
+
+	e.Host = u.Hostname()
+	if e.Host == "" {
+		return nil, fmt.Errorf("compose: no host in docker host '%v'", host)
+	}
+	if port := u.Port(); port != "" {
+		e.Port = port
+	}
+	return e, nil
+}
+
+// ResolveDockerEndpoint returns the endpoint the docker CLI would use: DOCKER_HOST if set, otherwise the Docker
+// context selected by DOCKER_CONTEXT or by the currentContext of the config.json in DOCKER_CONFIG, which defaults
+// to ~/.docker, and otherwise the default local socket.
+func ResolveDockerEndpoint() (*DockerEndpoint, error) {
+	configDir := dockerConfigDir()
+
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		e, err := ParseDockerHost(host)
+		if err != nil {
+			return nil, err
+		}
+		if e.Scheme == SchemeTCP && os.Getenv("DOCKER_TLS_VERIFY") != "" {
+			certPath := os.Getenv("DOCKER_CERT_PATH")
+			if certPath == "" {
+				certPath = configDir
+			}
+			e.TLS = tlsFiles(certPath, true)
+		}
+		return e, nil
+	}
+
+	name := os.Getenv("DOCKER_CONTEXT")
+	if name == "" {
+		name = currentContext(configDir)
+	}
+	if name == "" || name == defaultContext {
+		return defaultEndpoint(), nil
+	}
+	return loadContext(configDir, name)
+}
+
+func dockerConfigDir() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".docker"
+	}
+	return filepath.Join(home, ".docker")
+}
+
+func defaultEndpoint() *DockerEndpoint {
+	if runtime.GOOS == "windows" {
+		return &DockerEndpoint{Scheme: SchemeNpipe, Path: "//./pipe/docker_engine", Context: defaultContext}
+	}
+	return &DockerEndpoint{Scheme: SchemeUnix, Path: "/var/run/docker.sock", Context: defaultContext}
+}
+
+// currentContext reads the context selected by `docker context use`, a missing or unreadable config counts as none.
+func currentContext(configDir string) string {
+	bs, err := ioutil.ReadFile(filepath.Join(configDir, "config.json"))
+	if err != nil {
+		return ""
+	}
+	var config struct {
+		CurrentContext string `json:"currentContext"`
+	}
+	if err := json.Unmarshal(bs, &config); err != nil {
+		return ""
+	}
+	return config.CurrentContext
+}
+
+// loadContext reads a context from the metadata store, which keeps every context in a directory named after
+// the SHA-256 digest of its name.
+func loadContext(configDir, name string) (*DockerEndpoint, error) {
+	digest := sha256.Sum256([]byte(name))
+	id := hex.EncodeToString(digest[:])
+
+	bs, err := ioutil.ReadFile(filepath.Join(configDir, "contexts", "meta", id, "meta.json"))
+	if err != nil {
+		return nil, fmt.Errorf("compose: error reading docker context %s: %v", name, err)
+	}
+	var meta struct {
+		Endpoints map[string]struct {
+			Host          string `json:"Host"`
+			SkipTLSVerify bool   `json:"SkipTLSVerify"`
+		} `json:"Endpoints"`
+	}
+	if err := json.Unmarshal(bs, &meta); err != nil {
+		return nil, fmt.Errorf("compose: error parsing docker context %s: %v", name, err)
+	}
+	docker, ok := meta.Endpoints["docker"]
+	if !ok || docker.Host == "" {
+		return nil, fmt.Errorf("compose: docker context %s has no docker endpoint", name)
+	}
+
+	e, err := ParseDockerHost(docker.Host)
+	if err != nil {
+		return nil, err
+	}
+	e.Context = name
+	if e.Scheme == SchemeTCP {
+		tlsDir := filepath.Join(configDir, "contexts", "tls", id, "docker")
+		if tls := tlsFiles(tlsDir, !docker.SkipTLSVerify); tls.CAFile != "" || tls.CertFile != "" {
+			e.TLS = tls
+		}
+	}
+	return e, nil
+}
+
+// tlsFiles returns the TLS settings with the ca.pem, cert.pem and key.pem files found in dir.
+func tlsFiles(dir string, verify bool) *DockerTLS {
+	file := func(name string) string {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err != nil {
+			return ""
+		}
+		return path
+	}
+	return &DockerTLS{Verify: verify, CAFile: file("ca.pem"), CertFile: file("cert.pem"), KeyFile: file("key.pem")}
+}
+
+// publishHost returns the host ports published by the daemon are reached at,
+// using x to inspect the container the process runs in, if any.
+func (e *DockerEndpoint) publishHost(ctx context.Context, x Executor) string {
+	if !e.Local() {
+		return e.Host
+	}
+	if hostEnv.inContainer() && !hostEnv.hostNetwork(ctx, x) {
+		if gw, err := hostEnv.hostGateway(ctx); err == nil {
+			return gw
+		}
+	}
+	return "127.0.0.1"
+}
@@ -0,0 +1,123 @@
+package dccli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setEnv sets an environment variable for the duration of the test.
+func setEnv(t *testing.T, key, value string) {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+// localDocker makes the Docker endpoint resolve to the default local socket for the duration of the test,
+// whatever DOCKER_HOST, DOCKER_CONTEXT and the Docker config of the machine running the tests select.
+func localDocker(t *testing.T) {
+	setEnv(t, "DOCKER_HOST", "")
+	setEnv(t, "DOCKER_CONTEXT", "")
+	setEnv(t, "DOCKER_CONFIG", t.TempDir())
+}
+
+func TestParseDockerHost(t *testing.T) {
+	for host, want := range map[string]DockerEndpoint{
+		"unix:///var/run/docker.sock":    {Scheme: SchemeUnix, Path: "/var/run/docker.sock"},
+		"npipe:////./pipe/docker_engine": {Scheme: SchemeNpipe, Path: "//./pipe/docker_engine"},
+		"tcp://192.168.99.100:2376":      {Scheme: SchemeTCP, Host: "192.168.99.100", Port: "2376"},
+		"tcp://docker":                   {Scheme: SchemeTCP, Host: "docker", Port: "2375"},
+		"tcp://[::1]:2375":               {Scheme: SchemeTCP, Host: "::1", Port: "2375"},
+		"docker.example.com:2376":        {Scheme: SchemeTCP, Host: "docker.example.com", Port: "2376"},
+		"https://docker.example.com":     {Scheme: SchemeTCP, Host: "docker.example.com", Port: "2376"},
+		"ssh://deploy@build-host":        {Scheme: SchemeSSH, Host: "build-host", Port: "22", User: "deploy"},
+		"ssh://deploy@build-host:2222":   {Scheme: SchemeSSH, Host: "build-host", Port: "2222", User: "deploy"},
+		"SSH://[fe80::1]:2222":           {Scheme: SchemeSSH, Host: "fe80::1", Port: "2222"},
+	} {
+		e, err := ParseDockerHost(host)
+		require.NoError(t, err, host)
+		require.Equal(t, want, *e, host)
+	}
+	for _, host := range []string{"unix://", "tcp://", "tcp://:2375", "ftp://host", "tcp://host:port"} {
+		_, err := ParseDockerHost(host)
+		require.Error(t, err, host)
+	}
+}
+
+// writeContext stores a context in the metadata store below configDir like `docker context create` does.
+func writeContext(t *testing.T, configDir, name, meta string) string {
+	digest := sha256.Sum256([]byte(name))
+	id := hex.EncodeToString(digest[:])
+	writeComposeFile(t, filepath.Join(configDir, "contexts", "meta", id), "meta.json", meta)
+	return filepath.Join(configDir, "contexts", "tls", id, "docker")
+}
+
+func TestResolveDockerEndpoint(t *testing.T) {
+	notInContainer(t)
+	configDir := t.TempDir()
+	setEnv(t, "DOCKER_CONFIG", configDir)
+	setEnv(t, "DOCKER_HOST", "")
+	setEnv(t, "DOCKER_CONTEXT", "")
+	setEnv(t, "DOCKER_TLS_VERIFY", "")
+
+	e, err := ResolveDockerEndpoint()
+	require.NoError(t, err)
+	require.Equal(t, defaultEndpoint(), e, "no config falls back to the local socket")
+	require.Equal(t, "127.0.0.1", MustInferDockerHost())
+
+	writeContext(t, configDir, "remote", `{"Name":"remote","Metadata":{},"Endpoints":{"docker":{"Host":"ssh://deploy@build-host","SkipTLSVerify":false}}}`)
+	tlsDir := writeContext(t, configDir, "secure", `{"Name":"secure","Metadata":{},"Endpoints":{"docker":{"Host":"tcp://10.0.0.5:2376","SkipTLSVerify":true}}}`)
+	writeComposeFile(t, tlsDir, "ca.pem", "ca")
+	writeComposeFile(t, tlsDir, "cert.pem", "cert")
+	writeComposeFile(t, tlsDir, "key.pem", "key")
+
+	writeComposeFile(t, configDir, "config.json", `{"auths": {}, "currentContext": "remote"}`)
+	e, err = ResolveDockerEndpoint()
+	require.NoError(t, err)
+	require.Equal(t, &DockerEndpoint{Scheme: SchemeSSH, Host: "build-host", Port: "22", User: "deploy", Context: "remote"}, e)
+	require.Equal(t, "build-host", MustInferDockerHost())
+
+	setEnv(t, "DOCKER_CONTEXT", "secure")
+	e, err = ResolveDockerEndpoint()
+	require.NoError(t, err)
+	require.Equal(t, &DockerEndpoint{Scheme: SchemeTCP, Host: "10.0.0.5", Port: "2376", Context: "secure", TLS: &DockerTLS{
+		CAFile:   filepath.Join(tlsDir, "ca.pem"),
+		CertFile: filepath.Join(tlsDir, "cert.pem"),
+		KeyFile:  filepath.Join(tlsDir, "key.pem"),
+	}}, e)
+
+	setEnv(t, "DOCKER_CONTEXT", "missing")
+	_, err = ResolveDockerEndpoint()
+	require.Error(t, err)
+
+	setEnv(t, "DOCKER_CONTEXT", "default")
+	e, err = ResolveDockerEndpoint()
+	require.NoError(t, err)
+	require.Equal(t, defaultEndpoint(), e)
+
+	// DOCKER_HOST takes precedence over contexts
+	setEnv(t, "DOCKER_HOST", "tcp://[::1]:2376")
+	setEnv(t, "DOCKER_TLS_VERIFY", "1")
+	setEnv(t, "DOCKER_CERT_PATH", tlsDir)
+	e, err = ResolveDockerEndpoint()
+	require.NoError(t, err)
+	require.Equal(t, &DockerEndpoint{Scheme: SchemeTCP, Host: "::1", Port: "2376", TLS: &DockerTLS{
+		Verify:   true,
+		CAFile:   filepath.Join(tlsDir, "ca.pem"),
+		CertFile: filepath.Join(tlsDir, "cert.pem"),
+		KeyFile:  filepath.Join(tlsDir, "key.pem"),
+	}}, e)
+	require.Equal(t, "::1", MustInferDockerHost())
+
+	setEnv(t, "DOCKER_HOST", "unix:///var/run/docker.sock")
+	require.Equal(t, "127.0.0.1", MustInferDockerHost())
+}
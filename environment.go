@@ -0,0 +1,186 @@
+package dccli
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hostEnvironment holds where the detection of the environment the process runs in looks, so tests can stub it.
+type hostEnvironment struct {
+	dockerEnvPath string
+	cgroupPath    string
+	mountInfoPath string
+	routePath     string
+	lookupHost    func(ctx context.Context, host string) ([]string, error)
+	hostname      func() (string, error)
+}
+
+var (
+	hostEnv = hostEnvironment{
+		dockerEnvPath: "/.dockerenv",
+		cgroupPath:    "/proc/self/cgroup",
+		mountInfoPath: "/proc/self/mountinfo",
+		routePath:     "/proc/net/route",
+		lookupHost:    net.DefaultResolver.LookupHost,
+		hostname:      os.Hostname,
+	}
+	cgroupContainerRegexp    = regexp.MustCompile(`/(?:docker|kubepods|containerd|lxc)[/-]`)
+	cgroupContainerIDRegexp  = regexp.MustCompile(`([0-9a-f]{64})`)
+	mountInfoContainerRegexp = regexp.MustCompile(`/containers/([0-9a-f]{64})/`)
+)
+
+// InContainer reports whether the current process runs inside a container,
+// based on the /.dockerenv file Docker creates and on the cgroups of the process.
+func InContainer() bool {
+	return hostEnv.inContainer()
+}
+
+func (e hostEnvironment) inContainer() bool {
+	if _, err := os.Stat(e.dockerEnvPath); err == nil {
+		return true
+	}
+	cgroup, err := ioutil.ReadFile(e.cgroupPath)
+	return err == nil && cgroupContainerRegexp.Match(cgroup)
+}
+
+// selfContainerID returns the ID of the container the process runs in, falling back to the hostname,
+// which Docker sets to the short container ID unless configured otherwise.
+func (e hostEnvironment) selfContainerID() (string, error) {
+	if cgroup, err := ioutil.ReadFile(e.cgroupPath); err == nil {
+		if m := cgroupContainerIDRegexp.FindSubmatch(cgroup); m != nil {
+			return string(m[1]), nil
+		}
+	}
+	// with cgroup v2 the ID only shows up in the paths of the files Docker mounts into the container
+	if mountInfo, err := ioutil.ReadFile(e.mountInfoPath); err == nil {
+		if m := mountInfoContainerRegexp.FindSubmatch(mountInfo); m != nil {
+			return string(m[1]), nil
+		}
+	}
+	hostname, err := e.hostname()
+	if err != nil {
+		return "", fmt.Errorf("compose: cannot determine the ID of the current container: %v", err)
+	}
+	return hostname, nil
+}
+
+// hostGateway returns an address of the Docker host as seen from inside a container: host.docker.internal
+// if it resolves, as it does on Docker Desktop, and the gateway of the default route otherwise,
+// which for containers on the default bridge is the Docker host.
+func (e hostEnvironment) hostGateway(ctx context.Context) (string, error) {
+	if addrs, err := e.lookupHost(ctx, "host.docker.internal"); err == nil {
+		for _, addr := range addrs {
+			if ip := net.ParseIP(addr); ip != nil && ip.To4() != nil {
+				return addr, nil
+			}
+		}
+	}
+	return e.defaultGateway()
+}
+
+// hostNetwork reports whether the container the process runs in uses the network of the Docker host,
+// as CI agents run with --network host often do, so published ports are reached on the loopback interface
+// rather than through the gateway, which is the router of the host then. Containers which cannot be
+// inspected are assumed to have a network of their own.
+func (e hostEnvironment) hostNetwork(ctx context.Context, x Executor) bool {
+	id, err := e.selfContainerID()
+	if err != nil {
+		return false
+	}
+	self, err := inspect(ctx, x, id)
+	return err == nil && self.HostConfig != nil && self.HostConfig.NetworkMode == "host"
+}
+
+// defaultGateway reads the gateway of the default route from the kernel routing table.
+func (e hostEnvironment) defaultGateway() (string, error) {
+	f, err := os.Open(e.routePath)
+	if err != nil {
+		return "", fmt.Errorf("compose: error reading routing table: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		// the gateway is a hex encoded IPv4 address in host byte order, which is little endian on all supported platforms
+		gw, err := strconv.ParseUint(fields[2], 16, 32)
+		if err != nil || gw == 0 {
+			continue
+		}
+		ip := make(net.IP, 4)
+		binary.LittleEndian.PutUint32(ip, uint32(gw))
+		return ip.String(), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("compose: error reading routing table: %v", err)
+	}
+	return "", fmt.Errorf("compose: no default route found in %s", e.routePath)
+}
+
+// attachSelf connects the container the process runs in to every network of the project's containers,
+// so their container IPs can be reached. Networks it is connected to already are left alone.
+func (c *Compose) attachSelf(ctx context.Context) error {
+	if c.selfID == "" {
+		if !hostEnv.inContainer() {
+			c.logger.Println("not running in a container, so not attaching to the project networks")
+			return nil
+		}
+		id, err := hostEnv.selfContainerID()
+		if err != nil {
+			return err
+		}
+		c.selfID = id
+	}
+	self, err := inspect(ctx, c.cfg.executor, c.selfID)
+	if err != nil {
+		return fmt.Errorf("compose: error inspecting the current container: %w", err)
+	}
+
+	var networks []string
+	for _, replicas := range c.containers {
+		for _, container := range replicas {
+			if container.NetworkSettings == nil {
+				continue
+			}
+			for name := range container.NetworkSettings.Networks {
+				networks = appendUnique(networks, name)
+			}
+		}
+	}
+	sort.Strings(networks)
+	for _, name := range networks {
+		if self.NetworkSettings != nil && self.NetworkSettings.Networks[name] != nil {
+			continue
+		}
+		if _, err := dockerRun(ctx, &c.cfg, "network", "connect", name, c.selfID); err != nil {
+			return fmt.Errorf("compose: error attaching the current container to network %s: %w", name, err)
+		}
+		c.selfNetworks = append(c.selfNetworks, name)
+	}
+	return nil
+}
+
+// detachSelf disconnects the container the process runs in from the networks attachSelf connected it to,
+// as they cannot be removed otherwise.
+func (c *Compose) detachSelf(ctx context.Context) error {
+	var errs []error
+	for _, name := range c.selfNetworks {
+		if _, err := dockerRun(ctx, &c.cfg, "network", "disconnect", "-f", name, c.selfID); err != nil {
+			errs = append(errs, fmt.Errorf("compose: error detaching the current container from network %s: %w", name, err))
+		}
+	}
+	c.selfNetworks = nil
+	return combineErr(errs...)
+}
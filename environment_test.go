@@ -0,0 +1,154 @@
+package dccli
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+const selfID = "5f0c8e3b1a2d4c6e8f0a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8091a2b3c4"
+
+// stubHostEnv replaces the environment detection for the duration of the test.
+func stubHostEnv(t *testing.T, e hostEnvironment) {
+	old := hostEnv
+	hostEnv = e
+	t.Cleanup(func() { hostEnv = old })
+}
+
+// notInContainer makes the environment detection report that the test does not run in a container,
+// whether it does or not.
+func notInContainer(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	stubHostEnv(t, hostEnvironment{
+		dockerEnvPath: missing,
+		cgroupPath:    missing,
+		mountInfoPath: missing,
+		routePath:     missing,
+		lookupHost:    func(context.Context, string) ([]string, error) { return nil, errors.New("no such host") },
+		hostname:      func() (string, error) { return "test", nil },
+	})
+}
+
+// inContainer makes the environment detection report a container with the given files.
+func inContainer(t *testing.T, files map[string]string, hosts map[string][]string) {
+	dir := t.TempDir()
+	for name, content := range files {
+		writeComposeFile(t, dir, name, content)
+	}
+	stubHostEnv(t, hostEnvironment{
+		dockerEnvPath: filepath.Join(dir, "dockerenv"),
+		cgroupPath:    filepath.Join(dir, "cgroup"),
+		mountInfoPath: filepath.Join(dir, "mountinfo"),
+		routePath:     filepath.Join(dir, "route"),
+		lookupHost: func(ctx context.Context, host string) ([]string, error) {
+			if addrs, ok := hosts[host]; ok {
+				return addrs, nil
+			}
+			return nil, errors.New("no such host")
+		},
+		hostname: func() (string, error) { return "5f0c8e3b1a2d", nil },
+	})
+}
+
+const routeTable = `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	00000000	010011AC	0003	0	0	0	00000000	0	0	0
+eth0	000011AC	00000000	0001	0	0	0	0000FFFF	0	0	0
+`
+
+func TestInContainer(t *testing.T) {
+	notInContainer(t)
+	require.False(t, InContainer())
+
+	inContainer(t, map[string]string{"dockerenv": ""}, nil)
+	require.True(t, InContainer())
+
+	inContainer(t, map[string]string{"cgroup": "12:pids:/docker/" + selfID + "\n"}, nil)
+	require.True(t, InContainer())
+
+	inContainer(t, map[string]string{"cgroup": "0::/\n"}, nil)
+	require.False(t, InContainer())
+}
+
+func TestSelfContainerID(t *testing.T) {
+	inContainer(t, map[string]string{"cgroup": "12:pids:/docker/" + selfID + "\n"}, nil)
+	id, err := hostEnv.selfContainerID()
+	require.NoError(t, err)
+	require.Equal(t, selfID, id)
+
+	inContainer(t, map[string]string{
+		"cgroup":    "0::/\n",
+		"mountinfo": "722 700 254:1 /docker/containers/" + selfID + "/hostname /etc/hostname rw\n",
+	}, nil)
+	id, err = hostEnv.selfContainerID()
+	require.NoError(t, err)
+	require.Equal(t, selfID, id)
+
+	inContainer(t, map[string]string{"cgroup": "0::/\n"}, nil)
+	id, err = hostEnv.selfContainerID()
+	require.NoError(t, err)
+	require.Equal(t, "5f0c8e3b1a2d", id, "falls back to the hostname")
+}
+
+// selfInspect answers the inspection of the container inContainer reports, attached to the given network.
+func selfInspect(networkMode string) RecordedCommand {
+	return RecordedCommand{Args: []string{"docker", "inspect", "5f0c8e3b1a2d"},
+		Stdout: `[{"Id": "5f0c8e3b1a2d", "HostConfig": {"NetworkMode": "` + networkMode + `"}}]`}
+}
+
+func TestInferDockerHostInContainer(t *testing.T) {
+	localDocker(t)
+	infer := func(responses ...RecordedCommand) string {
+		host, err := inferDockerHost(context.Background(), NewReplayExecutor(responses...))
+		require.NoError(t, err)
+		return host
+	}
+
+	inContainer(t, map[string]string{"dockerenv": "", "route": routeTable},
+		map[string][]string{"host.docker.internal": {"fdc4:f303:9324::254", "192.168.65.2"}})
+	require.Equal(t, "192.168.65.2", infer(selfInspect("bridge")))
+
+	inContainer(t, map[string]string{"dockerenv": "", "route": routeTable}, nil)
+	require.Equal(t, "172.17.0.1", infer(selfInspect("bridge")), "falls back to the default gateway")
+	require.Equal(t, "172.17.0.1", infer(), "containers which cannot be inspected use the gateway as well")
+	require.Equal(t, "127.0.0.1", infer(selfInspect("host")), "the gateway is the router of the host on the host network")
+
+	inContainer(t, map[string]string{"dockerenv": ""}, nil)
+	require.Equal(t, "127.0.0.1", infer(selfInspect("bridge")))
+
+	setEnv(t, "DOCKER_HOST", "tcp://docker:2375")
+	require.Equal(t, "docker", MustInferDockerHost())
+}
+
+func TestAttachSelf(t *testing.T) {
+	e := NewReplayExecutor(
+		RecordedCommand{Args: []string{"docker", "inspect", selfID},
+			Stdout: `[{"Id": "` + selfID + `", "NetworkSettings": {"Networks": {"dccli_backend": {"IPAddress": "172.19.0.9"}}}}]`},
+		RecordedCommand{Args: []string{"docker", "network", "connect", "dccli_default", selfID}},
+		RecordedCommand{Args: []string{"docker", "network", "disconnect", "-f", "dccli_default", selfID}},
+	)
+	c := addressCompose(t, AddressAuto)
+	c.cfg.executor = e
+	inContainer(t, map[string]string{"cgroup": "12:pids:/docker/" + selfID + "\n"}, nil)
+
+	require.NoError(t, c.attachSelf(context.Background()))
+	require.Equal(t, []string{"dccli_default"}, c.selfNetworks, "networks the container is on already are left alone")
+
+	addr, err := c.Address("ms", 3000)
+	require.NoError(t, err)
+	require.Equal(t, "172.18.0.3:3000", addr, "attached containers use container IPs")
+
+	require.NoError(t, c.detachSelf(context.Background()))
+	require.Empty(t, c.selfNetworks)
+	require.Empty(t, e.Pending())
+}
+
+func TestAttachSelfOutsideContainer(t *testing.T) {
+	c := addressCompose(t, AddressAuto)
+	c.cfg.executor = NewReplayExecutor()
+
+	require.NoError(t, c.attachSelf(context.Background()))
+	require.Empty(t, c.selfNetworks)
+	require.NoError(t, c.detachSelf(context.Background()))
+}
@@ -0,0 +1,73 @@
+package dccli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+)
+
+// ExecOptions configures a command run by Compose.Exec.
+type ExecOptions struct {
+	// Stdin, if set, is passed to the command as its standard input.
+	Stdin io.Reader
+	// Env holds additional environment variables in the form "KEY=value".
+	Env []string
+	// User runs the command as the given user, in the form "name|uid[:group|gid]".
+	User string
+	// WorkDir runs the command in the given directory of the container.
+	WorkDir string
+}
+
+// ExecResult holds the outcome of a command run by Compose.Exec.
+type ExecResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// Exec runs cmd inside the container of the service using `docker exec`.
+// A command exiting with a non-zero code is not an error, its exit code is reported in the result;
+// an error is returned when the command could not be run at all.
+func (c *Compose) Exec(ctx context.Context, service string, cmd []string, opts *ExecOptions) (*ExecResult, error) {
+	container, err := c.cachedContainer(service)
+	if err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		opts = &ExecOptions{}
+	}
+
+	args := []string{"exec"}
+	if opts.Stdin != nil {
+		args = append(args, "--interactive")
+	}
+	for _, env := range opts.Env {
+		args = append(args, "--env", env)
+	}
+	if opts.User != "" {
+		args = append(args, "--user", opts.User)
+	}
+	if opts.WorkDir != "" {
+		args = append(args, "--workdir", opts.WorkDir)
+	}
+	args = append(args, container.ID)
+	args = append(args, cmd...)
+
+	var stdout, stderr bytes.Buffer
+	err = c.cfg.executor.Execute(ctx, Command{
+		Name:   "docker",
+		Args:   args,
+		Stdin:  opts.Stdin,
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	result := &ExecResult{Stdout: stdout.String(), Stderr: stderr.String(), ExitCode: exitCode(err)}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return result, fmt.Errorf("compose: error running %v in service %s: %w", cmd, service, ctxErr)
+	}
+	if result.ExitCode < 0 {
+		return result, fmt.Errorf("compose: error running %v in service %s: %v", cmd, service, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,39 @@
+package dccli
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestExec(t *testing.T) {
+	e := NewReplayExecutor(
+		RecordedCommand{
+			Args: []string{"docker", "exec", "--interactive", "--env", "PGPASSWORD=secret", "--user", "postgres",
+				"--workdir", "/tmp", msID, "psql", "-f", "-"},
+			Stdout: "CREATE TABLE\n",
+		},
+		RecordedCommand{Args: []string{"docker", "exec", msID, "false"}, Stderr: "oops\n", ExitCode: 1},
+	)
+	c := replayCompose(t, e)
+
+	result, err := c.Exec(context.Background(), "ms", []string{"psql", "-f", "-"}, &ExecOptions{
+		Stdin:   strings.NewReader("CREATE TABLE t (id int);"),
+		Env:     []string{"PGPASSWORD=secret"},
+		User:    "postgres",
+		WorkDir: "/tmp",
+	})
+	require.NoError(t, err)
+	require.Equal(t, &ExecResult{Stdout: "CREATE TABLE\n"}, result)
+
+	result, err = c.Exec(context.Background(), "ms", []string{"false"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, &ExecResult{Stderr: "oops\n", ExitCode: 1}, result)
+
+	_, err = c.Exec(context.Background(), "ms", []string{"unexpected"}, nil)
+	require.Error(t, err, "the replay executor has no response, so the command cannot run at all")
+
+	_, err = c.Exec(context.Background(), "mysql", []string{"true"}, nil)
+	require.Error(t, err)
+}
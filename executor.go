@@ -0,0 +1,239 @@
+package dccli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// AnyArg matches any single argument of a command served by a ReplayExecutor,
+// useful for arguments that differ between runs such as temporary file names.
+const AnyArg = "*"
+
+// Command describes a single invocation of an external program.
+type Command struct {
+	Name   string
+	Args   []string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Executor runs the docker and docker compose commands issued by dccli.
+// Errors for commands exiting with a non-zero status should implement `ExitCode() int`, as *exec.ExitError does.
+type Executor interface {
+	Execute(ctx context.Context, cmd Command) error
+}
+
+// ExecExecutor is the default Executor, it runs the commands on the host using os/exec.
+type ExecExecutor struct{}
+
+// Execute runs the command, killing it once ctx is done.
+func (ExecExecutor) Execute(ctx context.Context, c Command) error {
+	cmd := exec.CommandContext(ctx, c.Name, c.Args...)
+	cmd.Stdin = c.Stdin
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	// We need to prevent ctrl-c in the parent process from
+	// prematurely killing the docker command
+	// See https://stackoverflow.com/a/33171307/1403990
+	AssignProcAttr(cmd)
+	return cmd.Run()
+}
+
+// ExitError is returned by the ReplayExecutor for responses with a non-zero exit code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExitCode returns the exit code of the replayed command.
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// exitCode extracts the exit code from an error returned by an Executor, returning -1 when there is none.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var coder interface{ ExitCode() int }
+	if errors.As(err, &coder) {
+		return coder.ExitCode()
+	}
+	return -1
+}
+
+// RecordedCommand is a command captured by a RecordingExecutor, or a canned response served by a ReplayExecutor.
+type RecordedCommand struct {
+	// Args holds the program name followed by its arguments.
+	Args     []string `json:"args"`
+	Stdout   string   `json:"stdout,omitempty"`
+	Stderr   string   `json:"stderr,omitempty"`
+	ExitCode int      `json:"exitCode,omitempty"`
+}
+
+func (r RecordedCommand) matches(args []string) bool {
+	if len(r.Args) != len(args) {
+		return false
+	}
+	for i, a := range r.Args {
+		if a != AnyArg && a != args[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// RecordingExecutor wraps another Executor and records every command run through it, along with its output.
+type RecordingExecutor struct {
+	executor Executor
+	mu       sync.Mutex
+	commands []RecordedCommand
+}
+
+// NewRecordingExecutor returns a RecordingExecutor running its commands with e.
+func NewRecordingExecutor(e Executor) *RecordingExecutor {
+	return &RecordingExecutor{executor: e}
+}
+
+// Execute runs the command with the wrapped Executor and records it.
+func (r *RecordingExecutor) Execute(ctx context.Context, cmd Command) error {
+	var stdout, stderr bytes.Buffer
+	recorded := cmd
+	recorded.Stdout = teeWriter(cmd.Stdout, &stdout)
+	recorded.Stderr = teeWriter(cmd.Stderr, &stderr)
+
+	err := r.executor.Execute(ctx, recorded)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = append(r.commands, RecordedCommand{
+		Args:     append([]string{cmd.Name}, cmd.Args...),
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		ExitCode: exitCode(err),
+	})
+	return err
+}
+
+// Commands returns the commands recorded so far.
+func (r *RecordingExecutor) Commands() []RecordedCommand {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedCommand(nil), r.commands...)
+}
+
+// Save writes the recorded commands as JSON to the given file, to be loaded by LoadReplayExecutor.
+func (r *RecordingExecutor) Save(path string) error {
+	bs, err := json.MarshalIndent(r.Commands(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bs, 0644)
+}
+
+func teeWriter(w io.Writer, buf *bytes.Buffer) io.Writer {
+	if w == nil {
+		return buf
+	}
+	return io.MultiWriter(w, buf)
+}
+
+// ReplayExecutor serves canned responses instead of running commands.
+// Every response is used at most once, commands are answered by the first unused response with matching arguments.
+type ReplayExecutor struct {
+	mu        sync.Mutex
+	responses []RecordedCommand
+	used      []bool
+	calls     [][]string
+}
+
+// NewReplayExecutor returns a ReplayExecutor serving the given responses.
+func NewReplayExecutor(responses ...RecordedCommand) *ReplayExecutor {
+	return &ReplayExecutor{
+		responses: responses,
+		used:      make([]bool, len(responses)),
+	}
+}
+
+// LoadReplayExecutor returns a ReplayExecutor serving the commands saved by RecordingExecutor.Save.
+func LoadReplayExecutor(path string) (*ReplayExecutor, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var responses []RecordedCommand
+	if err := json.Unmarshal(bs, &responses); err != nil {
+		return nil, fmt.Errorf("compose: error parsing recording %s: %v", path, err)
+	}
+	return NewReplayExecutor(responses...), nil
+}
+
+// Execute writes the output of the matching response, failing for commands without one.
+func (r *ReplayExecutor) Execute(ctx context.Context, cmd Command) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	args := append([]string{cmd.Name}, cmd.Args...)
+
+	r.mu.Lock()
+	r.calls = append(r.calls, args)
+	var response *RecordedCommand
+	for i := range r.responses {
+		if !r.used[i] && r.responses[i].matches(args) {
+			r.used[i] = true
+			response = &r.responses[i]
+			break
+		}
+	}
+	r.mu.Unlock()
+
+	if response == nil {
+		return fmt.Errorf("compose: no replay response for: %s", strings.Join(args, " "))
+	}
+	if cmd.Stdout != nil {
+		if _, err := io.WriteString(cmd.Stdout, response.Stdout); err != nil {
+			return err
+		}
+	}
+	if cmd.Stderr != nil {
+		if _, err := io.WriteString(cmd.Stderr, response.Stderr); err != nil {
+			return err
+		}
+	}
+	if response.ExitCode != 0 {
+		return &ExitError{Code: response.ExitCode}
+	}
+	return nil
+}
+
+// Calls returns the arguments of every command received so far, including unanswered ones.
+func (r *ReplayExecutor) Calls() [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][]string(nil), r.calls...)
+}
+
+// Pending returns the responses which have not been used yet.
+func (r *ReplayExecutor) Pending() []RecordedCommand {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var pending []RecordedCommand
+	for i, used := range r.used {
+		if !used {
+			pending = append(pending, r.responses[i])
+		}
+	}
+	return pending
+}
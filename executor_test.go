@@ -0,0 +1,226 @@
+package dccli
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"testing"
+)
+
+var quietLogger = log.New(ioutil.Discard, "", 0)
+
+// inspectOutput returns canned `docker inspect` output for a running container of the given compose service.
+func inspectOutput(id, name, service string) string {
+	return inspectOutputWithState(id, name, service, `{"Running": true}`)
+}
+
+// inspectOutputWithState is like inspectOutput, but uses the given JSON for the state section.
+func inspectOutputWithState(id, name, service, state string) string {
+	return fmt.Sprintf(`[{
+  "Id": %q,
+  "Name": "/%s",
+  "Config": {"Labels": {"com.docker.compose.project": "dccli", "com.docker.compose.service": %q}},
+  "State": %s,
+  "NetworkSettings": {"Ports": {"3000/tcp": [{"HostIp": "0.0.0.0", "HostPort": "32768"}]}}
+}]`, id, name, service, state)
+}
+
+func composeCmd(args ...string) []string {
+	return append([]string{"docker-compose", "-f", AnyArg, "-p", "dccli"}, args...)
+}
+
+const (
+	msID    = "0123456789ab0123456789ab0123456789ab0123456789ab0123456789abcdef"
+	mysqlID = "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+)
+
+func startResponses() []RecordedCommand {
+	return []RecordedCommand{
+		{Args: composeCmd("up", "-d")},
+		{Args: composeCmd("ps", "-q"), Stdout: msID + "\n" + mysqlID + "\n", Stderr: "WARNING: some noise\n"},
+		{Args: []string{"docker", "inspect", msID}, Stdout: inspectOutput(msID, "dccli_ms_1", "ms")},
+		{Args: []string{"docker", "inspect", mysqlID}, Stdout: inspectOutput(mysqlID, "dccli_mysql_1", "mysql")},
+	}
+}
+
+// cleanupResponses are the commands run by Cleanup for a project without volumes.
+func cleanupResponses() []RecordedCommand {
+	return []RecordedCommand{
+		{Args: composeCmd("stop")},
+		{Args: composeCmd("kill")},
+		{Args: composeCmd("down", "-v", "--remove-orphans")},
+		{Args: []string{"docker", "network", "ls", "-q", "--filter", "label=com.docker.compose.project=dccli"}},
+		{Args: []string{"docker", "volume", "ls", "-q", "--filter", "label=com.docker.compose.project=dccli"}},
+	}
+}
+
+// composeOption adjusts the Compose built by replayCompose.
+type composeOption func(*Compose)
+
+// withHostPort publishes container port 3000 of the "ms" container on the given host port.
+func withHostPort(port string) composeOption {
+	return func(c *Compose) {
+		c.containers["ms"][0].NetworkSettings.Ports["3000/tcp"][0].HostPort = port
+	}
+}
+
+// withContainer replaces the containers of the service.
+func withContainer(service string, containers ...*ContainerInfo) composeOption {
+	return func(c *Compose) {
+		c.containers[service] = containers
+	}
+}
+
+// withOptions applies the options as Start would.
+func withOptions(opts ...Option) composeOption {
+	return func(c *Compose) {
+		for _, opt := range opts {
+			opt(&c.cfg)
+		}
+	}
+}
+
+// replayCompose returns a Compose for the cfg project, as if Start had run already, which runs its commands with e,
+// or fails them if e is nil. The "ms" container publishes container port 3000 on host port 32768.
+func replayCompose(t *testing.T, e Executor, opts ...composeOption) *Compose {
+	notInContainer(t)
+	localDocker(t)
+
+	if e == nil {
+		e = NewReplayExecutor()
+	}
+	c := &Compose{
+		publicCfg:   cfg,
+		projectName: "dccli",
+		logger:      quietLogger,
+		containers: map[string][]*ContainerInfo{
+			"ms": {{
+				ID: msID,
+				NetworkSettings: &NetworkSettings{Ports: map[string][]PortBinding{
+					"3000/tcp": {{HostPort: "32768"}},
+				}},
+			}},
+		},
+		cfg: internalCFG{outFile: "docker-compose.yaml", projectName: "dccli", backend: BackendV1, executor: e, logger: quietLogger},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func TestReplayStartAndCleanup(t *testing.T) {
+	notInContainer(t)
+	localDocker(t)
+	e := NewReplayExecutor(append(startResponses(), cleanupResponses()...)...)
+
+	c, err := Start(OptionWithCompose(cfg),
+		OptionWithLogger(quietLogger),
+		OptionBackend(BackendV1),
+		OptionWithExecutor(e))
+	require.NoError(t, err)
+
+	require.Equal(t, msID, c.containers["ms"][0].ID)
+	require.Equal(t, mysqlID, c.containers["mysql"][0].ID)
+	require.Equal(t, uint32(32768), c.containers["ms"][0].MustGetFirstPublicPort(3000, "tcp"))
+	require.NotContains(t, c.Config().Services["ms"].Labels, LabelSession, "session labels are only added with the reaper enabled")
+
+	require.NoError(t, c.Cleanup())
+	require.Empty(t, e.Pending())
+}
+
+func TestReplayStartIgnoresOrphans(t *testing.T) {
+	notInContainer(t)
+	localDocker(t)
+	const orphanID = "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"
+	responses := startResponses()
+	responses[1].Stdout += orphanID + "\n"
+	responses = append(responses, RecordedCommand{
+		Args:   []string{"docker", "inspect", orphanID},
+		Stdout: inspectOutput(orphanID, "dccli_removed_1", "removed"),
+	})
+	e := NewReplayExecutor(responses...)
+
+	c, err := Start(OptionWithCompose(cfg),
+		OptionWithLogger(quietLogger),
+		OptionBackend(BackendV1),
+		OptionWithExecutor(e))
+	require.NoError(t, err)
+	require.Len(t, c.containers, 2)
+	require.NotContains(t, c.containers, "removed")
+	require.Empty(t, e.Pending())
+}
+
+func TestReplayErrorParsing(t *testing.T) {
+	e := NewReplayExecutor(RecordedCommand{
+		Args:     []string{"docker", "inspect", "bad"},
+		Stdout:   "[]\n",
+		Stderr:   "Error: No such object: bad\n",
+		ExitCode: 1,
+	})
+
+	_, err := inspect(context.Background(), e, "bad")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Error: No such object: bad")
+	require.Contains(t, err.Error(), "exit status 1")
+}
+
+func TestReplayStartRetries(t *testing.T) {
+	notInContainer(t)
+	localDocker(t)
+	responses := append([]RecordedCommand{
+		{Args: composeCmd("up", "-d"), Stderr: "ERROR: for ms  Cannot start service ms\n", ExitCode: 1},
+	}, startResponses()...)
+	e := NewReplayExecutor(responses...)
+
+	c, err := Start(OptionWithCompose(cfg),
+		OptionWithLogger(quietLogger),
+		OptionBackend(BackendV1),
+		OptionStartRetries(2),
+		OptionWithExecutor(e))
+	require.NoError(t, err)
+	require.Len(t, c.containers, 2)
+	require.Empty(t, e.Pending())
+}
+
+func TestReplayStartFails(t *testing.T) {
+	notInContainer(t)
+	localDocker(t)
+	e := NewReplayExecutor(append([]RecordedCommand{{
+		Args:     composeCmd("up", "-d"),
+		Stderr:   "ERROR: pull access denied for nope\n",
+		ExitCode: 1,
+	}}, cleanupResponses()...)...)
+
+	c, err := Start(OptionWithCompose(cfg),
+		OptionWithLogger(quietLogger),
+		OptionBackend(BackendV1),
+		OptionStartRetries(1),
+		OptionWithExecutor(e))
+	require.Error(t, err)
+	require.Nil(t, c)
+	require.Contains(t, err.Error(), "ERROR: pull access denied for nope")
+	require.Empty(t, e.Pending(), "whatever up started is cleaned up")
+}
+
+func TestRecordingExecutor(t *testing.T) {
+	replay := NewReplayExecutor(RecordedCommand{Args: []string{"docker", "version"}, Stdout: "20.10.0\n"})
+	rec := NewRecordingExecutor(replay)
+
+	out, err := runCmd(context.Background(), rec, "docker", "version")
+	require.NoError(t, err)
+	require.Equal(t, "20.10.0\n", out)
+
+	path := filepath.Join(t.TempDir(), "recording.json")
+	require.NoError(t, rec.Save(path))
+
+	loaded, err := LoadReplayExecutor(path)
+	require.NoError(t, err)
+	out, err = runCmd(context.Background(), loaded, "docker", "version")
+	require.NoError(t, err)
+	require.Equal(t, "20.10.0\n", out)
+	require.Equal(t, [][]string{{"docker", "version"}}, loaded.Calls())
+}
@@ -0,0 +1,80 @@
+package dccli
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	healthPollInterval = 500 * time.Millisecond
+	// number of healthcheck runs included in the error of an unhealthy container
+	healthLogEntries = 3
+)
+
+// Health statuses reported by docker for containers with a healthcheck.
+const (
+	HealthStarting  = "starting"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// waitHealthy polls the containers until every container with a healthcheck reports healthy.
+// It fails early once a container with a healthcheck reports unhealthy or is no longer running.
+func (c *Compose) waitHealthy(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		if err := c.updateContainers(ctx); err != nil {
+			return fmt.Errorf("compose: error waiting for healthy containers: %w", err)
+		}
+
+		var waiting []string
+		for svc, replicas := range c.containers {
+			for _, container := range replicas {
+				health := container.State.Health
+				if health == nil {
+					// no healthcheck, nothing to wait for
+					continue
+				}
+				if !container.State.Running {
+					return fmt.Errorf("compose: container %s of service %s exited with code %d while waiting for it to become healthy%s",
+						strings.TrimPrefix(container.Name, "/"), svc, container.State.ExitCode, formatHealthLog(health))
+				}
+				switch health.Status {
+				case HealthHealthy:
+					continue
+				case HealthUnhealthy:
+					return fmt.Errorf("compose: container %s of service %s is unhealthy%s",
+						strings.TrimPrefix(container.Name, "/"), svc, formatHealthLog(health))
+				}
+				waiting = append(waiting, strings.TrimPrefix(container.Name, "/"))
+			}
+		}
+		if len(waiting) == 0 {
+			return nil
+		}
+
+		sort.Strings(waiting)
+		c.logger.Printf("waiting for %s to become healthy...", strings.Join(waiting, ", "))
+		if err := sleepContext(ctx, healthPollInterval); err != nil {
+			return fmt.Errorf("compose: error waiting for %s to become healthy: %w", strings.Join(waiting, ", "), err)
+		}
+	}
+}
+
+// formatHealthLog formats the last healthcheck runs of a container for use in an error message.
+func formatHealthLog(health *ContainerHealth) string {
+	entries := health.Log
+	if len(entries) > healthLogEntries {
+		entries = entries[len(entries)-healthLogEntries:]
+	}
+	var b strings.Builder
+	for _, entry := range entries {
+		fmt.Fprintf(&b, "\n\thealthcheck exited with %d: %s", entry.ExitCode, strings.TrimSpace(entry.Output))
+	}
+	return b.String()
+}
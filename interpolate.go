@@ -0,0 +1,266 @@
+package dccli
+
+import (
+	"bufio"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LookupFunc returns the value of the variable name and whether it is set, like os.LookupEnv does.
+type LookupFunc func(name string) (string, bool)
+
+// Interpolate returns a copy of cfg in which the variables in every value are substituted using lookup,
+// supporting the docker-compose syntax: $VAR, ${VAR}, ${VAR:-default} and ${VAR-default} for defaults,
+// ${VAR:?error} and ${VAR?error} for required variables, ${VAR:+replacement} and ${VAR+replacement},
+// and $$ for a literal dollar sign.
+func Interpolate(cfg Config, lookup LookupFunc) (Config, error) {
+	bs, err := yaml.Marshal(&cfg)
+	if err != nil {
+		return Config{}, err
+	}
+	var raw interface{}
+	if err := yaml.Unmarshal(bs, &raw); err != nil {
+		return Config{}, err
+	}
+	raw, err = mapStrings(raw, func(s string) (interface{}, error) { return interpolate(s, lookup) })
+	if err != nil {
+		return Config{}, err
+	}
+	if bs, err = yaml.Marshal(raw); err != nil {
+		return Config{}, err
+	}
+	var out Config
+	if err := yaml.Unmarshal(bs, &out); err != nil {
+		return Config{}, fmt.Errorf("compose: error parsing interpolated configuration: %v", err)
+	}
+	return out, nil
+}
+
+// marshalEscaped marshals an interpolated configuration, escaping every $ so docker-compose
+// does not try to interpolate the values a second time.
+func marshalEscaped(cfg Config) ([]byte, error) {
+	bs, err := yaml.Marshal(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	var raw interface{}
+	if err := yaml.Unmarshal(bs, &raw); err != nil {
+		return nil, err
+	}
+	raw, _ = mapStrings(raw, func(s string) (interface{}, error) { return escapeDollars(s), nil })
+	return yaml.Marshal(raw)
+}
+
+// interpolateRaw interpolates the values of a parsed docker-compose file, before it is parsed into a Config.
+// Values turning into a boolean or an integer are converted, so they can be parsed into fields such as privileged
+// or ulimits.
+func interpolateRaw(raw interface{}, lookup LookupFunc) (interface{}, error) {
+	return mapStrings(raw, func(s string) (interface{}, error) {
+		value, err := interpolate(s, lookup)
+		if err != nil {
+			return nil, err
+		}
+		if value != s {
+			if value == "true" || value == "false" {
+				return value == "true", nil
+			}
+			if n, err := strconv.Atoi(value); err == nil && strconv.Itoa(n) == value {
+				return n, nil
+			}
+		}
+		return value, nil
+	})
+}
+
+func escapeDollars(s string) string {
+	return strings.Replace(s, "$", "$$", -1)
+}
+
+// mapStrings applies fn to every string value of a parsed YAML document, leaving the keys alone.
+func mapStrings(v interface{}, fn func(string) (interface{}, error)) (interface{}, error) {
+	var err error
+	switch v := v.(type) {
+	case string:
+		return fn(v)
+	case map[interface{}]interface{}:
+		for k, e := range v {
+			if v[k], err = mapStrings(e, fn); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for i, e := range v {
+			if v[i], err = mapStrings(e, fn); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// interpolate substitutes the variables in a single value.
+func interpolate(s string, lookup LookupFunc) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			sb.WriteByte(s[i])
+			continue
+		}
+		if i+1 == len(s) {
+			return "", fmt.Errorf("compose: invalid interpolation format for %q: trailing $", s)
+		}
+
+		switch next := s[i+1]; {
+		case next == '$':
+			sb.WriteByte('$')
+			i++
+		case next == '{':
+			end := closingBrace(s[i:])
+			if end < 0 {
+				return "", fmt.Errorf("compose: invalid interpolation format for %q: missing }", s)
+			}
+			value, err := substitute(s[i+2:i+end], lookup)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(value)
+			i += end
+		case isNameChar(next, true):
+			end := i + 2
+			for end < len(s) && isNameChar(s[end], false) {
+				end++
+			}
+			value, _ := lookup(s[i+1 : end])
+			sb.WriteString(value)
+			i = end - 1
+		default:
+			return "", fmt.Errorf("compose: invalid interpolation format for %q", s)
+		}
+	}
+	return sb.String(), nil
+}
+
+// substitute resolves the expression between ${ and }.
+func substitute(expr string, lookup LookupFunc) (string, error) {
+	end := 0
+	for end < len(expr) && isNameChar(expr[end], end == 0) {
+		end++
+	}
+	name, op := expr[:end], expr[end:]
+	if name == "" {
+		return "", fmt.Errorf("compose: invalid interpolation format for ${%s}", expr)
+	}
+	value, ok := lookup(name)
+	if op == "" {
+		return value, nil
+	}
+
+	// a leading colon makes an empty variable count as unset
+	set := ok
+	if op[0] == ':' {
+		set = ok && value != ""
+		op = op[1:]
+	}
+	if op == "" {
+		return "", fmt.Errorf("compose: invalid interpolation format for ${%s}", expr)
+	}
+	arg := op[1:]
+	switch op[0] {
+	case '-':
+		if !set {
+			return interpolate(arg, lookup)
+		}
+		return value, nil
+	case '?':
+		if !set {
+			return "", fmt.Errorf("compose: required variable %s is missing a value: %s", name, arg)
+		}
+		return value, nil
+	case '+':
+		if set {
+			return interpolate(arg, lookup)
+		}
+		return "", nil
+	}
+	return "", fmt.Errorf("compose: invalid interpolation format for ${%s}", expr)
+}
+
+// closingBrace returns the index of the } closing the ${ s starts with, allowing nested expressions in defaults.
+func closingBrace(s string) int {
+	depth := 0
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isNameChar(c byte, first bool) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || !first && c >= '0' && c <= '9'
+}
+
+// readEnvFile parses a .env file: one KEY=value per line, with blank lines and lines starting with #
+// ignored, and optional quotes around the value removed.
+func readEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("compose: error reading env file: %v", err)
+	}
+	defer f.Close()
+
+	env := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("compose: invalid line %d in env file %s: %q", n, path, line)
+		}
+		value := strings.TrimSpace(parts[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		env[strings.TrimSpace(parts[0])] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("compose: error reading env file: %v", err)
+	}
+	return env, nil
+}
+
+// envLookup looks variables up using lookup first, falling back to the env files in reverse order,
+// so the environment takes precedence over env files and later files over earlier ones.
+func envLookup(lookup LookupFunc, envFiles []string) (LookupFunc, error) {
+	var envs []map[string]string
+	for _, path := range envFiles {
+		env, err := readEnvFile(path)
+		if err != nil {
+			return nil, err
+		}
+		envs = append(envs, env)
+	}
+	return func(name string) (string, bool) {
+		if value, ok := lookup(name); ok {
+			return value, true
+		}
+		for i := len(envs) - 1; i >= 0; i-- {
+			if value, ok := envs[i][name]; ok {
+				return value, true
+			}
+		}
+		return "", false
+	}, nil
+}
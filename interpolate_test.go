@@ -0,0 +1,84 @@
+package dccli
+
+import (
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+func mapLookup(env map[string]string) LookupFunc {
+	return func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	lookup := mapLookup(map[string]string{"TAG": "1.2", "EMPTY": "", "PORT": "8080"})
+	for in, want := range map[string]string{
+		"nats:${TAG}":              "nats:1.2",
+		"nats:$TAG":                "nats:1.2",
+		"${PORT}:${PORT}":          "8080:8080",
+		"${UNSET}":                 "",
+		"${UNSET:-latest}":         "latest",
+		"${UNSET-latest}":          "latest",
+		"${EMPTY:-latest}":         "latest",
+		"${EMPTY-latest}":          "",
+		"${TAG:-latest}":           "1.2",
+		"${UNSET:-${TAG}}":         "1.2",
+		"${TAG:+set}":              "set",
+		"${EMPTY:+set}":            "",
+		"${EMPTY+set}":             "set",
+		"${TAG:?tag is required}":  "1.2",
+		"echo $$HOME":              "echo $HOME",
+		"$${TAG}":                  "${TAG}",
+		"no variables in here":     "no variables in here",
+		"${PORT}-suffix and $TAG!": "8080-suffix and 1.2!",
+	} {
+		got, err := interpolate(in, lookup)
+		require.NoError(t, err, in)
+		require.Equal(t, want, got, in)
+	}
+
+	for _, in := range []string{"${UNSET:?tag is required}", "${EMPTY:?tag is required}", "${TAG", "${}", "trailing $", "$-"} {
+		_, err := interpolate(in, lookup)
+		require.Error(t, err, in)
+	}
+	_, err := interpolate("${UNSET?tag is required}", lookup)
+	require.EqualError(t, err, "compose: required variable UNSET is missing a value: tag is required")
+}
+
+func TestInterpolateConfig(t *testing.T) {
+	in := Config{Services: map[string]Service{"app": {
+		Image:       "app:${TAG:-latest}",
+		Environment: []string{"PASSWORD=pa$$word", "REGION=${REGION}"},
+		Labels:      Mapping{"tag": "${TAG}"},
+	}}}
+
+	lookup, err := envLookup(mapLookup(map[string]string{"REGION": "eu"}), []string{
+		writeComposeFile(t, t.TempDir(), ".env", "# defaults\nTAG=1.0\nREGION=us\n"),
+		writeComposeFile(t, t.TempDir(), ".env", "export TAG=\"2.0\"\n\n"),
+	})
+	require.NoError(t, err)
+	out, err := Interpolate(in, lookup)
+	require.NoError(t, err)
+
+	app := out.Services["app"]
+	require.Equal(t, "app:2.0", app.Image)
+	require.Equal(t, Environment{"PASSWORD=pa$word", "REGION=eu"}, app.Environment)
+	require.Equal(t, Mapping{"tag": "2.0"}, app.Labels)
+	require.Equal(t, "app:${TAG:-latest}", in.Services["app"].Image, "the passed in configuration is left alone")
+
+	bs, err := marshalEscaped(out)
+	require.NoError(t, err)
+	require.Contains(t, string(bs), "PASSWORD=pa$$word")
+}
+
+func TestEnvFileErrors(t *testing.T) {
+	_, err := envLookup(mapLookup(nil), []string{filepath.Join(t.TempDir(), "missing.env")})
+	require.Error(t, err)
+
+	_, err = envLookup(mapLookup(nil), []string{writeComposeFile(t, t.TempDir(), ".env", "TAG=1.0\nnot a variable\n")})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `invalid line 2 in env file`)
+}
@@ -0,0 +1,112 @@
+package dccli
+
+import (
+	"context"
+	"fmt"
+)
+
+// StopService stops the containers of the service without removing them.
+func (c *Compose) StopService(service string) error {
+	return c.StopServiceContext(context.Background(), service)
+}
+
+// StopServiceContext is like StopService, but gives up once ctx is done.
+func (c *Compose) StopServiceContext(ctx context.Context, service string) error {
+	return c.serviceCmd(ctx, service, "stop", service)
+}
+
+// StartService starts the stopped containers of the service.
+func (c *Compose) StartService(service string) error {
+	return c.StartServiceContext(context.Background(), service)
+}
+
+// StartServiceContext is like StartService, but gives up once ctx is done.
+func (c *Compose) StartServiceContext(ctx context.Context, service string) error {
+	return c.serviceCmd(ctx, service, "start", service)
+}
+
+// RestartService restarts the containers of the service.
+func (c *Compose) RestartService(service string) error {
+	return c.RestartServiceContext(context.Background(), service)
+}
+
+// RestartServiceContext is like RestartService, but gives up once ctx is done.
+func (c *Compose) RestartServiceContext(ctx context.Context, service string) error {
+	return c.serviceCmd(ctx, service, "restart", service)
+}
+
+// PauseService pauses the processes in the containers of the service.
+func (c *Compose) PauseService(service string) error {
+	return c.PauseServiceContext(context.Background(), service)
+}
+
+// PauseServiceContext is like PauseService, but gives up once ctx is done.
+func (c *Compose) PauseServiceContext(ctx context.Context, service string) error {
+	return c.serviceCmd(ctx, service, "pause", service)
+}
+
+// UnpauseService resumes the processes in the paused containers of the service.
+func (c *Compose) UnpauseService(service string) error {
+	return c.UnpauseServiceContext(context.Background(), service)
+}
+
+// UnpauseServiceContext is like UnpauseService, but gives up once ctx is done.
+func (c *Compose) UnpauseServiceContext(ctx context.Context, service string) error {
+	return c.serviceCmd(ctx, service, "unpause", service)
+}
+
+// KillService sends signal, such as "SIGTERM", to the containers of the service.
+// An empty signal sends SIGKILL.
+func (c *Compose) KillService(service string, signal string) error {
+	return c.KillServiceContext(context.Background(), service, signal)
+}
+
+// KillServiceContext is like KillService, but gives up once ctx is done.
+func (c *Compose) KillServiceContext(ctx context.Context, service string, signal string) error {
+	if signal == "" {
+		return c.serviceCmd(ctx, service, "kill", service)
+	}
+	return c.serviceCmd(ctx, service, "kill", "-s", signal, service)
+}
+
+// Scale starts or removes containers until the service runs n of them, leaving the existing ones untouched.
+// The new number of containers is kept for later calls to Up.
+func (c *Compose) Scale(service string, n int) error {
+	return c.ScaleContext(context.Background(), service, n)
+}
+
+// ScaleContext is like Scale, but gives up once ctx is done. The scale kept for Up only changes if the containers
+// were scaled.
+func (c *Compose) ScaleContext(ctx context.Context, service string, n int) error {
+	if n < 0 {
+		return fmt.Errorf("compose: cannot scale service %s to %d containers", service, n)
+	}
+	services, err := dependencyClosure(c.publicCfg, []string{service})
+	if err != nil {
+		return err
+	}
+	scale := make(map[string]int, len(c.cfg.scale)+1)
+	for s, m := range c.cfg.scale {
+		scale[s] = m
+	}
+	scale[service] = n
+	// the services it depends on are brought up as well, so they need their --scale flags too
+	args := append([]string{"up", "-d", "--no-recreate"}, scaleArgs(scale, services)...)
+	if _, err := composeRun(ctx, &c.cfg, append(args, service)...); err != nil {
+		return fmt.Errorf("compose: error scaling service %s: %w", service, err)
+	}
+	c.cfg.scale = scale
+	return c.updateContainers(ctx)
+}
+
+// serviceCmd runs a docker compose command against a single service, then refreshes the containers
+// since their state, and possibly their host ports, changed.
+func (c *Compose) serviceCmd(ctx context.Context, service string, args ...string) error {
+	if _, ok := c.publicCfg.Services[service]; !ok {
+		return fmt.Errorf("compose: no service %s found", service)
+	}
+	if _, err := composeRun(ctx, &c.cfg, args...); err != nil {
+		return fmt.Errorf("compose: error running %s for service %s: %w", args[0], service, err)
+	}
+	return c.updateContainers(ctx)
+}
@@ -0,0 +1,90 @@
+package dccli
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestServiceLifecycle(t *testing.T) {
+	var responses []RecordedCommand
+	for _, args := range [][]string{
+		{"stop", "ms"},
+		{"start", "ms"},
+		{"restart", "ms"},
+		{"pause", "ms"},
+		{"unpause", "ms"},
+		{"kill", "ms"},
+		{"kill", "-s", "SIGTERM", "ms"},
+	} {
+		responses = append(responses, RecordedCommand{Args: composeCmd(args...)})
+		responses = append(responses, refreshResponses()...)
+	}
+	e := NewReplayExecutor(responses...)
+	c := replayCompose(t, e)
+
+	require.NoError(t, c.StopService("ms"))
+	require.NoError(t, c.StartService("ms"))
+	require.NoError(t, c.RestartService("ms"))
+	require.NoError(t, c.PauseService("ms"))
+	require.NoError(t, c.UnpauseService("ms"))
+	require.NoError(t, c.KillService("ms", ""))
+	require.NoError(t, c.KillService("ms", "SIGTERM"))
+	require.Empty(t, e.Pending())
+
+	require.Error(t, c.StopService("nope"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.True(t, errors.Is(c.RestartServiceContext(ctx, "ms"), context.Canceled))
+	require.True(t, errors.Is(c.ScaleContext(ctx, "ms", 2), context.Canceled))
+	require.Empty(t, c.cfg.scale, "a failed scale is not kept for later calls to Up")
+}
+
+func TestServiceLifecycleRefreshesPorts(t *testing.T) {
+	// the restarted container publishes port 3000 on a new host port
+	restarted := strings.Replace(inspectOutput(msID, "dccli_ms_1", "ms"), `"HostPort": "32768"`, `"HostPort": "32769"`, 1)
+	c := replayCompose(t, NewReplayExecutor(
+		RecordedCommand{Args: composeCmd("restart", "ms")},
+		RecordedCommand{Args: composeCmd("ps", "-q"), Stdout: msID + "\n"},
+		RecordedCommand{Args: []string{"docker", "inspect", msID}, Stdout: restarted},
+	))
+	require.Equal(t, uint32(32768), c.containers["ms"][0].MustGetFirstPublicPort(3000, "tcp"))
+
+	require.NoError(t, c.RestartService("ms"))
+	require.Equal(t, uint32(32769), c.containers["ms"][0].MustGetFirstPublicPort(3000, "tcp"))
+}
+
+func TestComposeScale(t *testing.T) {
+	ms2ID := "1111111111111111111111111111111111111111111111111111111111111111"
+	e := NewReplayExecutor(
+		RecordedCommand{Args: composeCmd("up", "-d", "--no-recreate", "--scale", "ms=2", "--scale", "mysql=3", "ms")},
+		RecordedCommand{Args: composeCmd("ps", "-q"), Stdout: msID + "\n" + ms2ID + "\n"},
+		RecordedCommand{Args: []string{"docker", "inspect", msID}, Stdout: replicaInspectOutput(msID, "ms", 1)},
+		RecordedCommand{Args: []string{"docker", "inspect", ms2ID}, Stdout: replicaInspectOutput(ms2ID, "ms", 2)},
+		RecordedCommand{Args: composeCmd("ps", "-q"), Stdout: msID + "\n" + ms2ID + "\n"},
+		RecordedCommand{Args: []string{"docker", "inspect", msID}, Stdout: replicaInspectOutput(msID, "ms", 1)},
+		RecordedCommand{Args: []string{"docker", "inspect", ms2ID}, Stdout: replicaInspectOutput(ms2ID, "ms", 2)},
+	)
+	c := replayCompose(t, e)
+
+	// ms depends on the scaled mysql, which docker compose would scale back to a single container otherwise
+	ms := c.publicCfg.Services["ms"]
+	ms.DependsOn = ServiceDependencies{"mysql": {}}
+	c.publicCfg = Config{Services: map[string]Service{"ms": ms, "mysql": c.publicCfg.Services["mysql"]}}
+	c.cfg.scale = map[string]int{"mysql": 3}
+
+	require.NoError(t, c.Scale("ms", 2))
+	require.Equal(t, map[string]int{"ms": 2, "mysql": 3}, c.cfg.scale, "the new scale is kept for later calls to Up")
+	replicas, err := c.GetContainers("ms")
+	require.NoError(t, err)
+	require.Len(t, replicas, 2)
+	require.Equal(t, []string{msID, ms2ID}, []string{replicas[0].ID, replicas[1].ID})
+	require.Empty(t, e.Pending())
+
+	require.Error(t, c.Scale("nope", 2))
+	require.Error(t, c.Scale("ms", -1))
+	require.Equal(t, map[string]int{"ms": 2, "mysql": 3}, c.cfg.scale)
+}
@@ -0,0 +1,363 @@
+package dccli
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// service keys whose values are concatenated when merging files, instead of being replaced
+var concatenatedKeys = map[string]bool{
+	"ports":          true,
+	"expose":         true,
+	"external_links": true,
+	"dns":            true,
+	"dns_search":     true,
+	"tmpfs":          true,
+	"cap_add":        true,
+	"cap_drop":       true,
+	"extra_hosts":    true,
+	"env_file":       true,
+	"security_opt":   true,
+}
+
+// LoadConfig parses the given docker-compose files and merges them in order, the way docker-compose merges
+// multiple -f files: single values are replaced by the later files, lists such as ports are concatenated,
+// environment and labels are merged by key, and volumes and devices by their path in the container.
+// Relative paths used for builds, bind mounts and env files are resolved against the directory of their file.
+// Like docker-compose, the variables in every file are interpolated using the environment before anything else,
+// and every $$ becomes a literal dollar sign. The returned Config holds the values the containers see, so it should
+// not be passed to Interpolate again.
+func LoadConfig(paths ...string) (Config, error) {
+	return loadConfig(os.LookupEnv, paths)
+}
+
+// loadConfig is LoadConfig, interpolating the files using lookup.
+func loadConfig(lookup LookupFunc, paths []string) (Config, error) {
+	if len(paths) == 0 {
+		return Config{}, fmt.Errorf("compose: no files to load")
+	}
+
+	var merged map[interface{}]interface{}
+	for _, path := range paths {
+		raw, err := loadRaw(path, lookup)
+		if err != nil {
+			return Config{}, err
+		}
+		if merged == nil {
+			merged = raw
+			continue
+		}
+		merged = mergeTopLevel(merged, raw)
+	}
+
+	bs, err := yaml.Marshal(merged)
+	if err != nil {
+		return Config{}, fmt.Errorf("compose: error merging %v: %v", paths, err)
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(bs, &cfg); err != nil {
+		return Config{}, fmt.Errorf("compose: error parsing %v: %v", paths, err)
+	}
+	return cfg, nil
+}
+
+// loadRaw parses and interpolates a single file, then resolves its relative paths.
+func loadRaw(path string, lookup LookupFunc) (map[interface{}]interface{}, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("compose: error reading %s: %v", path, err)
+	}
+	raw := make(map[interface{}]interface{})
+	if err := yaml.Unmarshal(bs, &raw); err != nil {
+		return nil, fmt.Errorf("compose: error parsing %s: %v", path, err)
+	}
+	if _, err := interpolateRaw(raw, lookup); err != nil {
+		return nil, fmt.Errorf("compose: error interpolating %s: %w", path, err)
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(abs)
+	services, _ := raw["services"].(map[interface{}]interface{})
+	for _, svc := range services {
+		if svc, ok := svc.(map[interface{}]interface{}); ok {
+			resolveServicePaths(dir, svc)
+		}
+	}
+	return raw, nil
+}
+
+// resolveServicePaths makes the relative paths of a service absolute.
+func resolveServicePaths(dir string, svc map[interface{}]interface{}) {
+	switch build := svc["build"].(type) {
+	case string:
+		svc["build"] = resolvePath(dir, build)
+	case map[interface{}]interface{}:
+		if context, ok := build["context"].(string); ok {
+			build["context"] = resolvePath(dir, context)
+		}
+	}
+
+	switch envFile := svc["env_file"].(type) {
+	case string:
+		svc["env_file"] = resolvePath(dir, envFile)
+	case []interface{}:
+		for i, f := range envFile {
+			if f, ok := f.(string); ok {
+				envFile[i] = resolvePath(dir, f)
+			}
+		}
+	}
+
+	volumes, _ := svc["volumes"].([]interface{})
+	for i, v := range volumes {
+		switch v := v.(type) {
+		case string:
+			// short syntax, only sources which look like paths are bind mounts, the others are named volumes
+			parts := strings.SplitN(v, ":", 2)
+			if len(parts) == 2 && isRelativePath(parts[0]) {
+				volumes[i] = resolvePath(dir, parts[0]) + ":" + parts[1]
+			}
+		case map[interface{}]interface{}:
+			if source, ok := v["source"].(string); ok && v["type"] == "bind" {
+				v["source"] = resolvePath(dir, source)
+			}
+		}
+	}
+}
+
+func isRelativePath(p string) bool {
+	return p == "." || p == ".." || p == "~" ||
+		strings.HasPrefix(p, "./") || strings.HasPrefix(p, "../") || strings.HasPrefix(p, "~/")
+}
+
+// resolvePath resolves p against dir, leaving absolute paths and remote build contexts alone.
+func resolvePath(dir, p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, p[1:])
+		}
+		return p
+	}
+	if filepath.IsAbs(p) || strings.Contains(p, "://") || strings.HasPrefix(p, "git@") {
+		return p
+	}
+	return filepath.Join(dir, p)
+}
+
+// mergeTopLevel merges two parsed files, services are merged following the docker-compose rules
+// while the other sections are merged by key.
+func mergeTopLevel(base, override map[interface{}]interface{}) map[interface{}]interface{} {
+	for k, v := range override {
+		if k != "services" {
+			base[k] = mergeValues(base[k], v)
+			continue
+		}
+		baseServices, _ := base[k].(map[interface{}]interface{})
+		overrideServices, ok := v.(map[interface{}]interface{})
+		if baseServices == nil || !ok {
+			base[k] = v
+			continue
+		}
+		for name, svc := range overrideServices {
+			baseSvc, _ := baseServices[name].(map[interface{}]interface{})
+			overrideSvc, ok := svc.(map[interface{}]interface{})
+			if baseSvc == nil || !ok {
+				baseServices[name] = svc
+				continue
+			}
+			baseServices[name] = mergeService(baseSvc, overrideSvc)
+		}
+	}
+	return base
+}
+
+func mergeService(base, override map[interface{}]interface{}) map[interface{}]interface{} {
+	for k, v := range override {
+		key, _ := k.(string)
+		existing, ok := base[k]
+		if !ok {
+			base[k] = v
+			continue
+		}
+		switch {
+		case key == "environment":
+			base[k] = mappingToList(mergeMappings(existing, v))
+		case key == "labels":
+			base[k] = mergeMappings(existing, v)
+		case key == "volumes" || key == "devices":
+			base[k] = mergeByTarget(existing, v)
+		case key == "depends_on":
+			base[k] = mergeNamed(existing, v, dependsOnEntry)
+		case key == "networks":
+			base[k] = mergeNamed(existing, v, nil)
+		case concatenatedKeys[key]:
+			base[k] = concatUnique(existing, v)
+		default:
+			base[k] = mergeValues(existing, v)
+		}
+	}
+	return base
+}
+
+// mergeValues merges maps by key, any other value is replaced by the override.
+func mergeValues(base, override interface{}) interface{} {
+	baseMap, ok := base.(map[interface{}]interface{})
+	overrideMap, ok2 := override.(map[interface{}]interface{})
+	if !ok || !ok2 {
+		return override
+	}
+	for k, v := range overrideMap {
+		baseMap[k] = mergeValues(baseMap[k], v)
+	}
+	return baseMap
+}
+
+// toMapping converts a mapping given either as a map or as a list of "KEY=value" entries to a map.
+func toMapping(v interface{}) map[interface{}]interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		return v
+	case []interface{}:
+		m := make(map[interface{}]interface{}, len(v))
+		for _, entry := range v {
+			parts := strings.SplitN(fmt.Sprint(entry), "=", 2)
+			if len(parts) == 2 {
+				m[parts[0]] = parts[1]
+			} else {
+				m[parts[0]] = nil
+			}
+		}
+		return m
+	}
+	return map[interface{}]interface{}{}
+}
+
+func mergeMappings(base, override interface{}) map[interface{}]interface{} {
+	merged := toMapping(base)
+	for k, v := range toMapping(override) {
+		merged[k] = v
+	}
+	return merged
+}
+
+// mappingToList converts a mapping back to a sorted list of "KEY=value" entries.
+func mappingToList(m map[interface{}]interface{}) []interface{} {
+	list := make([]interface{}, 0, len(m))
+	for k, v := range m {
+		if v == nil {
+			list = append(list, fmt.Sprint(k))
+		} else {
+			list = append(list, fmt.Sprintf("%v=%v", k, v))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].(string) < list[j].(string) })
+	return list
+}
+
+// mergeByTarget merges mounts by their path in the container, in either short or long syntax.
+func mergeByTarget(base, override interface{}) interface{} {
+	baseList, _ := base.([]interface{})
+	overrideList, ok := override.([]interface{})
+	if !ok {
+		return override
+	}
+	merged := append([]interface{}(nil), baseList...)
+	for _, o := range overrideList {
+		replaced := false
+		for i, b := range merged {
+			if mountTarget(b) == mountTarget(o) {
+				merged[i] = o
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, o)
+		}
+	}
+	return merged
+}
+
+func mountTarget(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		parts := strings.Split(v, ":")
+		if len(parts) == 1 {
+			return parts[0]
+		}
+		return parts[1]
+	case map[interface{}]interface{}:
+		return fmt.Sprint(v["target"])
+	}
+	return fmt.Sprint(v)
+}
+
+// mergeNamed merges lists of names or maps keyed by name, such as depends_on and networks. If the result is a map,
+// the names from lists map to the value returned by entry, or to nil if entry is nil.
+func mergeNamed(base, override interface{}, entry func() interface{}) interface{} {
+	baseList, baseIsList := base.([]interface{})
+	overrideList, overrideIsList := override.([]interface{})
+	if baseIsList && overrideIsList {
+		return concatUnique(baseList, overrideList)
+	}
+	merged := namedToMap(base, entry)
+	for k, v := range namedToMap(override, entry) {
+		merged[k] = mergeValues(merged[k], v)
+	}
+	return merged
+}
+
+func namedToMap(v interface{}, entry func() interface{}) map[interface{}]interface{} {
+	if list, ok := v.([]interface{}); ok {
+		m := make(map[interface{}]interface{}, len(list))
+		for _, name := range list {
+			m[name] = nil
+			if entry != nil {
+				m[name] = entry()
+			}
+		}
+		return m
+	}
+	if m, ok := v.(map[interface{}]interface{}); ok {
+		return m
+	}
+	return map[interface{}]interface{}{}
+}
+
+// dependsOnEntry returns the map syntax of a dependency listed by name, which requires a condition.
+func dependsOnEntry() interface{} {
+	return map[interface{}]interface{}{"condition": ConditionServiceStarted}
+}
+
+func concatUnique(base, override interface{}) interface{} {
+	baseList, ok := base.([]interface{})
+	if !ok && base != nil {
+		baseList = []interface{}{base}
+	}
+	overrideList, ok := override.([]interface{})
+	if !ok {
+		overrideList = []interface{}{override}
+	}
+	merged := append([]interface{}(nil), baseList...)
+	for _, o := range overrideList {
+		found := false
+		for _, b := range merged {
+			if fmt.Sprint(b) == fmt.Sprint(o) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, o)
+		}
+	}
+	return merged
+}
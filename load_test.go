@@ -0,0 +1,232 @@
+package dccli
+
+import (
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeComposeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	base := writeComposeFile(t, dir, "docker-compose.yml", `version: '3.7'
+services:
+  app:
+    image: app:1.0
+    build: ./app
+    command: ["serve", "--debug"]
+    ports:
+    - "8080:8080"
+    environment:
+    - LOG_LEVEL=debug
+    - REGION=eu
+    labels:
+      team: core
+    volumes:
+    - ./data:/data
+    - cache:/cache
+    depends_on:
+    - db
+  db:
+    image: postgres:13
+volumes:
+  cache: {}
+`)
+	override := writeComposeFile(t, filepath.Join(dir, "override"), "docker-compose.override.yml", `services:
+  app:
+    image: app:2.0
+    command: ["serve"]
+    ports:
+    - "9090:9090"
+    environment:
+      LOG_LEVEL: info
+    labels:
+      owner: me
+    volumes:
+    - ../fixtures:/data
+    depends_on:
+    - cache
+  cache:
+    image: redis:6
+`)
+
+	cfg, err := LoadConfig(base, override)
+	require.NoError(t, err)
+	require.Equal(t, "3.7", cfg.Version)
+	require.Len(t, cfg.Services, 3)
+	require.Contains(t, cfg.Volumes, "cache")
+
+	app := cfg.Services["app"]
+	require.Equal(t, "app:2.0", app.Image)
+	require.Equal(t, ShellCommand{"serve"}, app.Command)
+	require.Equal(t, ServicePorts{{Target: 8080, Published: "8080"}, {Target: 9090, Published: "9090"}}, app.Ports)
+	require.Equal(t, Environment{"LOG_LEVEL=info", "REGION=eu"}, app.Environment)
+	require.Equal(t, Mapping{"team": "core", "owner": "me"}, app.Labels)
+	require.Equal(t, []string{"cache", "db"}, app.DependsOn.Services())
+	require.Equal(t, filepath.Join(dir, "app"), app.Build.Context)
+
+	require.Len(t, app.Volumes, 2)
+	require.Equal(t, filepath.Join(dir, "fixtures"), app.Volumes[0].Source)
+	require.Equal(t, "/data", app.Volumes[0].Target)
+	require.Equal(t, "cache", app.Volumes[1].Source)
+}
+
+func TestLoadConfigMergesDependsOn(t *testing.T) {
+	dir := t.TempDir()
+	base := writeComposeFile(t, dir, "docker-compose.yml", `services:
+  app:
+    image: app
+    depends_on:
+    - cache
+  cache:
+    image: redis
+  db:
+    image: postgres
+`)
+	override := writeComposeFile(t, dir, "docker-compose.override.yml", `services:
+  app:
+    depends_on:
+      db:
+        condition: service_healthy
+`)
+
+	baseRaw, err := loadRaw(base, mapLookup(nil))
+	require.NoError(t, err)
+	overrideRaw, err := loadRaw(override, mapLookup(nil))
+	require.NoError(t, err)
+	app := mergeTopLevel(baseRaw, overrideRaw)["services"].(map[interface{}]interface{})["app"]
+	require.Equal(t, map[interface{}]interface{}{
+		"cache": map[interface{}]interface{}{"condition": ConditionServiceStarted},
+		"db":    map[interface{}]interface{}{"condition": ConditionServiceHealthy},
+	}, app.(map[interface{}]interface{})["depends_on"], "the listed dependencies get the condition the map syntax requires")
+}
+
+func TestLoadConfigVolumeMode(t *testing.T) {
+	dir := t.TempDir()
+	path := writeComposeFile(t, dir, "docker-compose.yml", `services:
+  db:
+    image: postgres:13
+    volumes:
+    - ./init:/docker-entrypoint-initdb.d:ro
+    - /var/run/docker.sock:/var/run/docker.sock
+    - data:/data
+    - /anon
+`)
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	volumes := cfg.Services["db"].Volumes
+	require.Len(t, volumes, 4)
+	require.Equal(t, Volume{Source: filepath.Join(dir, "init"), Target: "/docker-entrypoint-initdb.d", Type: "bind", Mode: "ro"}, *volumes[0])
+	require.Equal(t, Volume{Source: "/var/run/docker.sock", Target: "/var/run/docker.sock", Type: "bind"}, *volumes[1])
+	require.Equal(t, Volume{Source: "data", Target: "/data", Type: "volume"}, *volumes[2])
+	require.Equal(t, Volume{Target: "/anon", Type: "volume"}, *volumes[3])
+
+	// the long syntax written for Start requires the type of every volume
+	bs, err := marshalEscaped(cfg)
+	require.NoError(t, err)
+	var written struct {
+		Services map[string]struct {
+			Volumes []interface{} `yaml:"volumes"`
+		} `yaml:"services"`
+	}
+	require.NoError(t, yaml.Unmarshal(bs, &written))
+	require.Equal(t, []interface{}{
+		filepath.Join(dir, "init") + ":/docker-entrypoint-initdb.d:ro",
+		map[interface{}]interface{}{"type": "bind", "source": "/var/run/docker.sock", "target": "/var/run/docker.sock"},
+		map[interface{}]interface{}{"type": "volume", "source": "data", "target": "/data"},
+		map[interface{}]interface{}{"type": "volume", "target": "/anon"},
+	}, written.Services["db"].Volumes)
+}
+
+func TestLoadConfigInterpolation(t *testing.T) {
+	setEnv(t, "PORT", "3000")
+	setEnv(t, "PRIV", "true")
+	setEnv(t, "ENV_DIR", "/etc/app")
+	dir := t.TempDir()
+	path := writeComposeFile(t, dir, "docker-compose.yml", `services:
+  app:
+    image: app:${TAG:-latest}
+    privileged: ${PRIV:-false}
+    ports:
+    - "8080:${PORT}"
+    ulimits:
+      nofile: ${NOFILE:-1024}
+    env_file:
+    - ${ENV_DIR}/app.env
+    - ${LOCAL_ENV_DIR:-./env}/app.env
+    environment:
+    - PASSWORD=pa$$word
+`)
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	app := cfg.Services["app"]
+	require.Equal(t, "app:latest", app.Image)
+	require.True(t, app.Privileged)
+	require.Equal(t, ServicePorts{{Target: 3000, Published: "8080"}}, app.Ports)
+	require.Equal(t, &Ulimit{Single: 1024}, app.Ulimits["nofile"])
+	require.Equal(t, StringList{"/etc/app/app.env", filepath.Join(dir, "env", "app.env")}, app.EnvFile)
+	require.Equal(t, Environment{"PASSWORD=pa$word"}, app.Environment, "literal dollar signs are unescaped")
+
+	bs, err := marshalEscaped(cfg)
+	require.NoError(t, err)
+	require.Contains(t, string(bs), "PASSWORD=pa$$word", "literal dollar signs are escaped again in the written file")
+
+	_, err = loadConfig(mapLookup(nil), []string{writeComposeFile(t, dir, "bad.yml", "services:\n  app:\n    image: ${TAG?tag is required}\n")})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "required variable TAG is missing a value")
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	_, err := LoadConfig()
+	require.Error(t, err)
+
+	_, err = LoadConfig(filepath.Join(t.TempDir(), "missing.yml"))
+	require.Error(t, err)
+
+	bad := writeComposeFile(t, t.TempDir(), "docker-compose.yml", "services: [")
+	_, err = LoadConfig(bad)
+	require.Error(t, err)
+}
+
+func TestStartWithComposeFiles(t *testing.T) {
+	notInContainer(t)
+	localDocker(t)
+	dir := t.TempDir()
+	path := writeComposeFile(t, dir, "docker-compose.yml", `services:
+  ms:
+    image: ubuntu:${TAG}
+    environment:
+    - PASSWORD=pa$$word
+  mysql:
+    image: mysql:5.7
+`)
+	out := filepath.Join(dir, "written.yml")
+	e := NewReplayExecutor(append(startResponses(), cleanupResponses()...)...)
+
+	c, err := Start(OptionWithComposeFiles(path),
+		OptionLookupEnv(mapLookup(map[string]string{"TAG": "trusty"})),
+		OptionWithLogger(quietLogger),
+		OptionBackend(BackendV1),
+		OptionWithExecutor(e),
+		OptionWriteToFile(out))
+	require.NoError(t, err)
+	defer c.MustCleanup()
+
+	require.Equal(t, "ubuntu:trusty", c.Config().Services["ms"].Image)
+	require.Equal(t, Environment{"PASSWORD=pa$word"}, c.Config().Services["ms"].Environment, "files are only interpolated once")
+	bs, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	require.Contains(t, string(bs), "PASSWORD=pa$$word")
+}
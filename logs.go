@@ -0,0 +1,111 @@
+package dccli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// how long Cleanup waits for LogsTo to write the logs of the stopped containers
+const logFollowerGrace = 5 * time.Second
+
+// LogOptions configures the logs returned by Compose.Logs.
+type LogOptions struct {
+	// Follow keeps the logs open, streaming new output until the reader is closed or the container stops.
+	Follow bool
+	// Tail limits the logs to the given number of lines from the end, all lines are returned when zero.
+	Tail int
+	// Since limits the logs to the ones written after the given time.
+	Since time.Time
+	// Timestamps prefixes every line with its timestamp.
+	Timestamps bool
+}
+
+func (o LogOptions) args() []string {
+	var args []string
+	if o.Follow {
+		args = append(args, "--follow")
+	}
+	if o.Tail > 0 {
+		args = append(args, "--tail", strconv.Itoa(o.Tail))
+	}
+	if !o.Since.IsZero() {
+		args = append(args, "--since", o.Since.Format(time.RFC3339Nano))
+	}
+	if o.Timestamps {
+		args = append(args, "--timestamps")
+	}
+	return args
+}
+
+// cmdReader streams the output of a command, closing it kills the command.
+type cmdReader struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+}
+
+func (r *cmdReader) Close() error {
+	r.cancel()
+	return r.PipeReader.Close()
+}
+
+// Logs returns the logs of the first container of the service, combining its stdout and stderr.
+// The caller has to close the returned reader.
+func (c *Compose) Logs(ctx context.Context, service string, opts LogOptions) (io.ReadCloser, error) {
+	container, err := c.cachedContainer(service)
+	if err != nil {
+		return nil, err
+	}
+	return c.containerLogs(ctx, "service "+service, container, opts)
+}
+
+// containerLogs returns the logs of the container, what describes the container in errors.
+func (c *Compose) containerLogs(ctx context.Context, what string, container *ContainerInfo, opts LogOptions) (io.ReadCloser, error) {
+	args := append([]string{"logs"}, opts.args()...)
+	args = append(args, container.ID)
+
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	go func() {
+		err := c.cfg.executor.Execute(ctx, Command{Name: "docker", Args: args, Stdout: pw, Stderr: pw})
+		if err != nil && ctx.Err() == nil {
+			err = fmt.Errorf("compose: error reading logs of %s: %w", what, err)
+		}
+		pw.CloseWithError(err)
+	}()
+	return &cmdReader{PipeReader: pr, cancel: cancel}, nil
+}
+
+// LogsTo follows the logs of all the services, writing them to w until the containers are stopped by Cleanup.
+func (c *Compose) LogsTo(w io.Writer) {
+	ctx, cancel := context.WithCancel(context.Background())
+	name, args := composeArgs(&c.cfg, "logs", "--follow", "--no-color")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := c.cfg.executor.Execute(ctx, Command{Name: name, Args: args, Stdout: w, Stderr: w})
+		if err != nil && ctx.Err() == nil {
+			c.logger.Printf("following logs failed: %v", err)
+		}
+	}()
+	c.logFollowers = append(c.logFollowers, func(grace time.Duration) {
+		select {
+		case <-done:
+		case <-time.After(grace):
+		}
+		cancel()
+		<-done
+	})
+}
+
+// stopFollowingLogs stops every LogsTo call, waiting for them to be done writing.
+// Followers exit by themselves once the containers are stopped, the grace period gives them a chance to
+// write the last lines before being killed.
+func (c *Compose) stopFollowingLogs(grace time.Duration) {
+	for _, stop := range c.logFollowers {
+		stop(grace)
+	}
+	c.logFollowers = nil
+}
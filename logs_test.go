@@ -0,0 +1,88 @@
+package dccli
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestLogs(t *testing.T) {
+	since := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	e := NewReplayExecutor(
+		RecordedCommand{
+			Args:   []string{"docker", "logs", "--tail", "10", "--since", "2020-01-02T03:04:05Z", "--timestamps", msID},
+			Stdout: "serving at port 3000\n",
+			Stderr: "GET / 200\n",
+		},
+		RecordedCommand{Args: []string{"docker", "logs", msID}, Stderr: "Error: No such container\n", ExitCode: 1},
+	)
+	c := replayCompose(t, e)
+
+	r, err := c.Logs(context.Background(), "ms", LogOptions{Tail: 10, Since: since, Timestamps: true})
+	require.NoError(t, err)
+	out, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, "serving at port 3000\nGET / 200\n", string(out))
+
+	r, err = c.Logs(context.Background(), "ms", LogOptions{})
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(r)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "error reading logs of service ms")
+	require.NoError(t, r.Close())
+
+	_, err = c.Logs(context.Background(), "mysql", LogOptions{})
+	require.Error(t, err)
+}
+
+func TestLogsTo(t *testing.T) {
+	e := NewReplayExecutor(
+		RecordedCommand{Args: composeCmd("logs", "--follow", "--no-color"), Stdout: "ms_1  | serving at port 3000\n"},
+		RecordedCommand{Args: composeCmd("stop")},
+	)
+	c := replayCompose(t, e, withOptions(OptionKeepAround(true)))
+
+	var buf bytes.Buffer
+	c.LogsTo(&buf)
+	require.NoError(t, c.Cleanup())
+	require.Equal(t, "ms_1  | serving at port 3000\n", buf.String())
+	require.Empty(t, e.Pending())
+}
+
+// followingExecutor follows logs until ctx is done, passing every other command on to Executor.
+type followingExecutor struct {
+	Executor
+	stopped chan struct{}
+}
+
+func (e *followingExecutor) Execute(ctx context.Context, cmd Command) error {
+	for _, arg := range cmd.Args {
+		if arg == "--follow" {
+			<-ctx.Done()
+			close(e.stopped)
+			return ctx.Err()
+		}
+	}
+	return e.Executor.Execute(ctx, cmd)
+}
+
+func TestLogsToStopsWhenCleanupFails(t *testing.T) {
+	replay := NewReplayExecutor(
+		RecordedCommand{Args: composeCmd("stop"), Stderr: "ERROR: stopping timed out\n", ExitCode: 1},
+	)
+	e := &followingExecutor{Executor: replay, stopped: make(chan struct{})}
+	c := replayCompose(t, e)
+
+	c.LogsTo(ioutil.Discard)
+	require.Error(t, c.Cleanup())
+	select {
+	case <-e.stopped:
+	default:
+		require.Fail(t, "the logs are still followed")
+	}
+	require.Empty(t, replay.Pending())
+}
@@ -2,6 +2,8 @@ package dccli
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -14,10 +16,60 @@ type Config struct {
 }
 
 type Network struct {
-	Driver   string
-	External string
-	//DriverOpts map[string]string "driver_opts"
-	Extension map[string]interface{} `yaml:",inline,omitempty"`
+	Driver     string                 `yaml:"driver,omitempty"`
+	DriverOpts map[string]string      `yaml:"driver_opts,omitempty"`
+	IPAM       *IPAM                  `yaml:"ipam,omitempty"`
+	Internal   bool                   `yaml:"internal,omitempty"`
+	Attachable bool                   `yaml:"attachable,omitempty"`
+	External   External               `yaml:"external,omitempty"`
+	Name       string                 `yaml:"name,omitempty"`
+	Labels     Mapping                `yaml:"labels,omitempty"`
+	Extension  map[string]interface{} `yaml:",inline,omitempty"`
+}
+
+// IPAM configures the IP address management of a network.
+type IPAM struct {
+	Driver  string            `yaml:"driver,omitempty"`
+	Config  []IPAMPool        `yaml:"config,omitempty"`
+	Options map[string]string `yaml:"options,omitempty"`
+}
+
+// IPAMPool is a subnet addresses of a network are assigned from.
+type IPAMPool struct {
+	Subnet       string            `yaml:"subnet,omitempty"`
+	IPRange      string            `yaml:"ip_range,omitempty"`
+	Gateway      string            `yaml:"gateway,omitempty"`
+	AuxAddresses map[string]string `yaml:"aux_addresses,omitempty"`
+}
+
+// External marks a network as created outside of the project, given either as a bool
+// or in the legacy form naming the existing network.
+type External struct {
+	External bool
+	Name     string
+}
+
+func (e *External) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var external bool
+	if err := unmarshal(&external); err == nil {
+		*e = External{External: external}
+		return nil
+	}
+	var named struct {
+		Name string `yaml:"name"`
+	}
+	if err := unmarshal(&named); err != nil {
+		return err
+	}
+	*e = External{External: true, Name: named.Name}
+	return nil
+}
+
+func (e External) MarshalYAML() (interface{}, error) {
+	if e.Name != "" {
+		return map[string]string{"name": e.Name}, nil
+	}
+	return e.External, nil
 }
 
 type Volume struct {
@@ -28,6 +80,9 @@ type Volume struct {
 	Type       string                 `yaml:"type,omitempty"`
 	DriverOpts map[string]string      `yaml:"services,omitempty"`
 	Volume     map[string]interface{} `yaml:"volume,omitempty"`
+	// Mode holds the access mode of the short syntax, e.g. ro, rw, z or Z. Volumes with a mode are
+	// marshaled back into the short syntax.
+	Mode string `yaml:"-"`
 }
 
 type volToMarshal struct {
@@ -38,6 +93,7 @@ type volToMarshal struct {
 	Type       string                 `yaml:"type,omitempty"`
 	DriverOpts map[string]string      `yaml:"services,omitempty"`
 	Volume     map[string]interface{} `yaml:"volume,omitempty"`
+	Mode       string                 `yaml:"-"`
 }
 
 func (v *Volume) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -46,11 +102,20 @@ func (v *Volume) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	var old string
 	if err := unmarshal(&old); err == nil {
 		strs := strings.Split(old, ":")
-		if len(strs) != 2 {
+		switch len(strs) {
+		case 1:
+			v.Target = strs[0]
+		case 2, 3:
+			v.Source = strs[0]
+			v.Target = strs[1]
+			if len(strs) == 3 {
+				v.Mode = strs[2]
+			}
+		default:
 			return fmt.Errorf("invalid format: %s", old)
 		}
-		v.Source = strs[0]
-		v.Target = strs[1]
+		// the long syntax the volume is marshaled into requires the type
+		v.Type = volumeType(v.Source)
 		return nil
 	}
 
@@ -62,28 +127,164 @@ func (v *Volume) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return fmt.Errorf("could not unmarshal into volumes")
 }
 
-//func (v Volume) MarshalYAML() (interface{}, error) {
-//	if v.oldStyle != "" {
-//		return v.oldStyle, nil
-//	}
-//	return v.VolumeLongSyntax, nil
-//}
+func (v Volume) MarshalYAML() (interface{}, error) {
+	if v.Mode != "" {
+		return v.Source + ":" + v.Target + ":" + v.Mode, nil
+	}
+	if v.Type == "" {
+		v.Type = volumeType(v.Source)
+	}
+	return volToMarshal(v), nil
+}
+
+// volumeType returns the type of a volume given in the short syntax: sources which look like paths are bind mounts,
+// the others are named volumes, and volumes without a source are anonymous ones.
+func volumeType(source string) string {
+	if strings.HasPrefix(source, "/") || strings.HasPrefix(source, ".") || strings.HasPrefix(source, "~") {
+		return "bind"
+	}
+	return "volume"
+}
 
 type Service struct {
-	//ContainerName string   `yaml:"container_name,omitempty"`
-	Image      string   `yaml:"image,omitempty"`
-	Entrypoint string   `yaml:"entrypoint,omitempty"`
-	Networks   []string `yaml:"networks,omitempty"`
-	//Expose        []string    `yaml:"expose,omitempty"`
-	Hostname    string                 `yaml:"hostname,omitempty"`
-	Ports       []string               `yaml:"ports,omitempty"`
-	Volumes     []*Volume              `yaml:"volumes,omitempty"`
-	Command     []string               `yaml:"command,omitempty"`
-	HealthCheck HealthCheck            `yaml:"healthcheck,omitempty"`
-	DependsOn   []string               `yaml:"depends_on,omitempty"`
-	Environment []string               `yaml:"environment,omitempty"`
-	Deploy      map[string]interface{} `yaml:"deploy,omitempty"`
-	Extension   map[string]interface{} `yaml:",inline,omitempty"`
+	Build           *Build                 `yaml:"build,omitempty"`
+	ContainerName   string                 `yaml:"container_name,omitempty"`
+	Image           string                 `yaml:"image,omitempty"`
+	Entrypoint      ShellCommand           `yaml:"entrypoint,omitempty"`
+	Networks        ServiceNetworks        `yaml:"networks,omitempty"`
+	Expose          []string               `yaml:"expose,omitempty"`
+	Hostname        string                 `yaml:"hostname,omitempty"`
+	Ports           ServicePorts           `yaml:"ports,omitempty"`
+	Volumes         []*Volume              `yaml:"volumes,omitempty"`
+	Tmpfs           StringList             `yaml:"tmpfs,omitempty"`
+	Command         ShellCommand           `yaml:"command,omitempty"`
+	HealthCheck     HealthCheck            `yaml:"healthcheck,omitempty"`
+	DependsOn       ServiceDependencies    `yaml:"depends_on,omitempty"`
+	Environment     Environment            `yaml:"environment,omitempty"`
+	EnvFile         StringList             `yaml:"env_file,omitempty"`
+	User            string                 `yaml:"user,omitempty"`
+	WorkingDir      string                 `yaml:"working_dir,omitempty"`
+	Ulimits         map[string]*Ulimit     `yaml:"ulimits,omitempty"`
+	CapAdd          []string               `yaml:"cap_add,omitempty"`
+	CapDrop         []string               `yaml:"cap_drop,omitempty"`
+	Privileged      bool                   `yaml:"privileged,omitempty"`
+	Init            bool                   `yaml:"init,omitempty"`
+	ShmSize         string                 `yaml:"shm_size,omitempty"`
+	Restart         string                 `yaml:"restart,omitempty"`
+	ExtraHosts      []string               `yaml:"extra_hosts,omitempty"`
+	StopSignal      string                 `yaml:"stop_signal,omitempty"`
+	StopGracePeriod string                 `yaml:"stop_grace_period,omitempty"`
+	Deploy          map[string]interface{} `yaml:"deploy,omitempty"`
+	Labels          Mapping                `yaml:"labels,omitempty"`
+	Extension       map[string]interface{} `yaml:",inline,omitempty"`
+}
+
+// Build describes how to build the image of a service, either from just a context or in the long syntax.
+type Build struct {
+	Context    string   `yaml:"context,omitempty"`
+	Dockerfile string   `yaml:"dockerfile,omitempty"`
+	Args       Mapping  `yaml:"args,omitempty"`
+	Target     string   `yaml:"target,omitempty"`
+	CacheFrom  []string `yaml:"cache_from,omitempty"`
+	Network    string   `yaml:"network,omitempty"`
+	Labels     Mapping  `yaml:"labels,omitempty"`
+}
+
+type buildToMarshal Build
+
+func (b *Build) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var context string
+	if err := unmarshal(&context); err == nil {
+		*b = Build{Context: context}
+		return nil
+	}
+	var long buildToMarshal
+	if err := unmarshal(&long); err != nil {
+		return err
+	}
+	*b = Build(long)
+	return nil
+}
+
+// MarshalYAML uses the short syntax when only the context is set.
+func (b Build) MarshalYAML() (interface{}, error) {
+	if b.Dockerfile == "" && len(b.Args) == 0 && b.Target == "" && len(b.CacheFrom) == 0 &&
+		b.Network == "" && len(b.Labels) == 0 {
+		return b.Context, nil
+	}
+	return buildToMarshal(b), nil
+}
+
+// Mapping is a map of strings, given either as a YAML map or as a list of "key=value" entries.
+type Mapping map[string]string
+
+func (m *Mapping) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*m = make(Mapping, len(list))
+		for _, entry := range list {
+			parts := strings.SplitN(entry, "=", 2)
+			if len(parts) == 2 {
+				(*m)[parts[0]] = parts[1]
+			} else {
+				(*m)[parts[0]] = ""
+			}
+		}
+		return nil
+	}
+	var mapping map[string]string
+	if err := unmarshal(&mapping); err != nil {
+		return err
+	}
+	*m = mapping
+	return nil
+}
+
+// StringList is a list of strings, given either as a YAML list or as a single string.
+type StringList []string
+
+func (l *StringList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		*l = StringList{single}
+		return nil
+	}
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// Ulimit is either a single limit or a pair of soft and hard limits.
+type Ulimit struct {
+	Single int `yaml:"-"`
+	Soft   int `yaml:"soft,omitempty"`
+	Hard   int `yaml:"hard,omitempty"`
+}
+
+type ulimitToMarshal Ulimit
+
+func (u *Ulimit) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single int
+	if err := unmarshal(&single); err == nil {
+		*u = Ulimit{Single: single}
+		return nil
+	}
+	var pair ulimitToMarshal
+	if err := unmarshal(&pair); err != nil {
+		return err
+	}
+	*u = Ulimit(pair)
+	return nil
+}
+
+func (u Ulimit) MarshalYAML() (interface{}, error) {
+	if u.Single != 0 {
+		return u.Single, nil
+	}
+	return ulimitToMarshal(u), nil
 }
 
 type RestartPolicy struct {
@@ -94,9 +295,397 @@ type RestartPolicy struct {
 }
 
 type HealthCheck struct {
-	Test        []string `yaml:"test,omitempty"`
-	Interval    string   `yaml:"interval,omitempty"`
-	Timeout     string   `yaml:"timeout,omitempty"`
-	StartPeriod string   `yaml:"start_period,omitempty"`
-	Retries     string   `yaml:"retries,omitempty"`
+	Test        HealthCheckTest `yaml:"test,omitempty"`
+	Interval    string          `yaml:"interval,omitempty"`
+	Timeout     string          `yaml:"timeout,omitempty"`
+	StartPeriod string          `yaml:"start_period,omitempty"`
+	Retries     string          `yaml:"retries,omitempty"`
+}
+
+// HealthCheckTest is the healthcheck command, starting with NONE, CMD or CMD-SHELL.
+// The string form is short for CMD-SHELL and is marshaled back that way.
+type HealthCheckTest []string
+
+func (t *HealthCheckTest) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		*t = HealthCheckTest{"CMD-SHELL", single}
+		return nil
+	}
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+func (t HealthCheckTest) MarshalYAML() (interface{}, error) {
+	if len(t) == 2 && t[0] == "CMD-SHELL" {
+		return t[1], nil
+	}
+	return []string(t), nil
+}
+
+// ServiceNetwork configures how a service is attached to a network.
+type ServiceNetwork struct {
+	Aliases     []string `yaml:"aliases,omitempty"`
+	IPv4Address string   `yaml:"ipv4_address,omitempty"`
+	IPv6Address string   `yaml:"ipv6_address,omitempty"`
+}
+
+// ServiceNetworks maps the networks a service is attached to to their configuration,
+// given either as a map or as a YAML list of network names.
+type ServiceNetworks map[string]*ServiceNetwork
+
+func (n *ServiceNetworks) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*n = make(ServiceNetworks, len(list))
+		for _, name := range list {
+			(*n)[name] = nil
+		}
+		return nil
+	}
+	var mapping map[string]*ServiceNetwork
+	if err := unmarshal(&mapping); err != nil {
+		return err
+	}
+	*n = mapping
+	return nil
+}
+
+// MarshalYAML uses the list syntax unless a network has a configuration.
+func (n ServiceNetworks) MarshalYAML() (interface{}, error) {
+	names := make([]string, 0, len(n))
+	for name, network := range n {
+		if network != nil {
+			return map[string]*ServiceNetwork(n), nil
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Environment is a list of "KEY=value" entries, given either as a YAML list or as a map.
+// Entries without a value are passed through from the environment docker-compose runs in.
+type Environment []string
+
+func (e *Environment) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*e = list
+		return nil
+	}
+	var mapping map[string]interface{}
+	if err := unmarshal(&mapping); err != nil {
+		return err
+	}
+	env := make(Environment, 0, len(mapping))
+	for k, v := range mapping {
+		if v == nil {
+			env = append(env, k)
+		} else {
+			env = append(env, fmt.Sprintf("%s=%v", k, v))
+		}
+	}
+	sort.Strings(env)
+	*e = env
+	return nil
+}
+
+// ShellCommand is a command as a list of arguments, given either as a YAML list or as a single string,
+// which is split into arguments following the quoting rules of a POSIX shell.
+type ShellCommand []string
+
+func (c *ShellCommand) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		args, err := splitShell(single)
+		if err != nil {
+			return err
+		}
+		*c = args
+		return nil
+	}
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*c = list
+	return nil
+}
+
+// splitShell splits s into words like a shell would, without expanding anything.
+func splitShell(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\\':
+			if i+1 == len(s) {
+				return nil, fmt.Errorf("trailing backslash in command %q", s)
+			}
+			i++
+			word.WriteByte(s[i])
+			inWord = true
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote in command %q", s)
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				// within double quotes, a backslash only escapes characters that are special there
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\\\"$`\n", s[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, fmt.Errorf("unterminated quote in command %q", s)
+			}
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// ServicePort is a port published by a service.
+type ServicePort struct {
+	// Mode is either host or ingress, only supported in swarm mode and by the long syntax.
+	Mode   string `yaml:"mode,omitempty"`
+	HostIP string `yaml:"host_ip,omitempty"`
+	// Target is the port inside the container.
+	Target uint32 `yaml:"target,omitempty"`
+	// Published is the host port or range of host ports, a random one is chosen when empty.
+	Published string `yaml:"published,omitempty"`
+	Protocol  string `yaml:"protocol,omitempty"`
+}
+
+type servicePortToMarshal ServicePort
+
+// MarshalYAML uses the short syntax unless a field only the long syntax supports is set.
+func (p ServicePort) MarshalYAML() (interface{}, error) {
+	if p.Mode != "" {
+		return servicePortToMarshal(p), nil
+	}
+	spec := strconv.FormatUint(uint64(p.Target), 10)
+	if p.HostIP != "" {
+		ip := p.HostIP
+		if strings.Contains(ip, ":") {
+			ip = "[" + ip + "]"
+		}
+		spec = ip + ":" + p.Published + ":" + spec
+	} else if p.Published != "" {
+		spec = p.Published + ":" + spec
+	}
+	if p.Protocol != "" {
+		spec += "/" + p.Protocol
+	}
+	return spec, nil
+}
+
+// ServicePorts is a list of ports, each given either in the short syntax, as in "127.0.0.1:8080:80/tcp",
+// or in the long syntax. Short specs with a range of container ports yield one ServicePort per port.
+type ServicePorts []ServicePort
+
+func (ps *ServicePorts) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var items []interface{}
+	if err := unmarshal(&items); err != nil {
+		return err
+	}
+	var ports ServicePorts
+	for _, item := range items {
+		switch item := item.(type) {
+		case string, int:
+			parsed, err := parsePortSpec(fmt.Sprint(item))
+			if err != nil {
+				return err
+			}
+			ports = append(ports, parsed...)
+		case map[interface{}]interface{}:
+			p := ServicePort{
+				Mode:      fmt.Sprint(valueOr(item["mode"], "")),
+				HostIP:    fmt.Sprint(valueOr(item["host_ip"], "")),
+				Published: fmt.Sprint(valueOr(item["published"], "")),
+				Protocol:  fmt.Sprint(valueOr(item["protocol"], "")),
+			}
+			target, err := strconv.ParseUint(fmt.Sprint(item["target"]), 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid target port %v", item["target"])
+			}
+			p.Target = uint32(target)
+			ports = append(ports, p)
+		default:
+			return fmt.Errorf("invalid port %v", item)
+		}
+	}
+	*ps = ports
+	return nil
+}
+
+func valueOr(v, def interface{}) interface{} {
+	if v == nil {
+		return def
+	}
+	return v
+}
+
+// parsePortSpec parses a port in the short syntax: [[ip:]host[-range]:]container[-range][/protocol].
+func parsePortSpec(spec string) ([]ServicePort, error) {
+	rest, protocol := spec, ""
+	if i := strings.LastIndex(rest, "/"); i >= 0 {
+		rest, protocol = rest[:i], rest[i+1:]
+	}
+
+	// the ip may be an IPv6 address in brackets, so split off the ports from the right
+	var ip, host, container string
+	parts := strings.Split(rest, ":")
+	switch {
+	case len(parts) == 1:
+		container = parts[0]
+	case len(parts) == 2:
+		host, container = parts[0], parts[1]
+	default:
+		ip = strings.Join(parts[:len(parts)-2], ":")
+		host, container = parts[len(parts)-2], parts[len(parts)-1]
+		if ip == "" {
+			return nil, fmt.Errorf("empty ip in port %q", spec)
+		}
+		ip = strings.TrimSuffix(strings.TrimPrefix(ip, "["), "]")
+	}
+
+	first, last, err := portRange(container)
+	if err != nil {
+		return nil, fmt.Errorf("invalid container port in %q: %v", spec, err)
+	}
+	if first == last {
+		return []ServicePort{{HostIP: ip, Target: uint32(first), Published: host, Protocol: protocol}}, nil
+	}
+
+	// a range of container ports is published on a range of host ports of the same size
+	var hostFirst int
+	if host != "" {
+		var hostLast int
+		if hostFirst, hostLast, err = portRange(host); err != nil {
+			return nil, fmt.Errorf("invalid host port in %q: %v", spec, err)
+		}
+		if hostLast-hostFirst != last-first {
+			return nil, fmt.Errorf("host and container port ranges of %q differ in size", spec)
+		}
+	}
+	var ports []ServicePort
+	for i := 0; i <= last-first; i++ {
+		p := ServicePort{HostIP: ip, Target: uint32(first + i), Protocol: protocol}
+		if host != "" {
+			p.Published = strconv.Itoa(hostFirst + i)
+		}
+		ports = append(ports, p)
+	}
+	return ports, nil
+}
+
+// portRange parses a port or a range of ports like 8000-8010.
+func portRange(s string) (first, last int, err error) {
+	bounds := strings.SplitN(s, "-", 2)
+	var ports []int
+	for _, b := range bounds {
+		p, err := strconv.Atoi(b)
+		if err != nil || p < 1 || p > 65535 {
+			return 0, 0, fmt.Errorf("%q is not a port between 1 and 65535", b)
+		}
+		ports = append(ports, p)
+	}
+	if len(ports) == 1 {
+		return ports[0], ports[0], nil
+	}
+	if ports[1] < ports[0] {
+		return 0, 0, fmt.Errorf("range %q ends before it starts", s)
+	}
+	return ports[0], ports[1], nil
+}
+
+// Conditions a service can wait for in ServiceDependency.
+const (
+	ConditionServiceStarted               = "service_started"
+	ConditionServiceHealthy               = "service_healthy"
+	ConditionServiceCompletedSuccessfully = "service_completed_successfully"
+)
+
+// ServiceDependency describes what a service waits for before starting after the service it depends on.
+type ServiceDependency struct {
+	// Condition defaults to ConditionServiceStarted.
+	Condition string `yaml:"condition,omitempty"`
+}
+
+// ServiceDependencies maps the services a service depends on to the condition it waits for,
+// given either as a map or as a YAML list of service names.
+type ServiceDependencies map[string]ServiceDependency
+
+func (d *ServiceDependencies) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*d = make(ServiceDependencies, len(list))
+		for _, service := range list {
+			(*d)[service] = ServiceDependency{Condition: ConditionServiceStarted}
+		}
+		return nil
+	}
+	var mapping map[string]ServiceDependency
+	if err := unmarshal(&mapping); err != nil {
+		return err
+	}
+	*d = mapping
+	return nil
+}
+
+// MarshalYAML uses the list syntax unless a dependency waits for more than the service to be started.
+// The map syntax requires a condition for every dependency, so missing ones are set to ConditionServiceStarted.
+func (d ServiceDependencies) MarshalYAML() (interface{}, error) {
+	for _, dep := range d {
+		if dep.Condition != "" && dep.Condition != ConditionServiceStarted {
+			return d.withConditions(), nil
+		}
+	}
+	return d.Services(), nil
+}
+
+func (d ServiceDependencies) withConditions() map[string]ServiceDependency {
+	deps := make(map[string]ServiceDependency, len(d))
+	for service, dep := range d {
+		if dep.Condition == "" {
+			dep.Condition = ConditionServiceStarted
+		}
+		deps[service] = dep
+	}
+	return deps
+}
+
+// Services returns the names of the services depended on, sorted.
+func (d ServiceDependencies) Services() []string {
+	services := make([]string, 0, len(d))
+	for service := range d {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	return services
 }
@@ -52,10 +52,10 @@ networks:
 	tgSvc := cfg.Services["ten-gallon"]
 
 	require.NotNil(t, tgSvc)
-	//assert.Equal(t, "homedepot", tgSvc.ContainerName)
+	assert.Equal(t, "homedepot", tgSvc.ContainerName)
 	assert.Equal(t, "gcr.io/theia-bot/ten-gallon:0.0.1", tgSvc.Image)
 	assert.Contains(t, tgSvc.Command, "serve")
-	assert.NotContains(t, tgSvc.Ports, "6600:6600")
+	assert.Empty(t, tgSvc.Ports)
 
 	require.NotNil(t, tgSvc.HealthCheck)
 	tgHealth := tgSvc.HealthCheck
@@ -69,7 +69,8 @@ networks:
 	assert.Equal(t, "20", tgHealth.Retries)
 
 	assert.Contains(t, tgSvc.DependsOn, "nats")
-
+	assert.Equal(t, []string{"4222"}, cfg.Services["nats"].Expose)
+	assert.Equal(t, ShellCommand{"/gnatsd", "-DV"}, cfg.Services["nats"].Entrypoint)
 }
 
 func TestDependsOn(t *testing.T) {
@@ -151,3 +152,295 @@ volumes:
 	require.NoError(t, err)
 
 }
+
+func TestServiceRoundTrip(t *testing.T) {
+	const yamlSource = `
+services:
+  app:
+    build:
+      context: ./app
+      dockerfile: Dockerfile.dev
+      args:
+      - VERSION=1.0
+      target: dev
+    container_name: app
+    labels:
+    - team=core
+    - tier
+    env_file: .env
+    user: "1000:1000"
+    working_dir: /srv
+    ulimits:
+      nproc: 65535
+      nofile:
+        soft: 20000
+        hard: 40000
+    tmpfs: /run
+    cap_add:
+    - NET_ADMIN
+    cap_drop:
+    - ALL
+    privileged: true
+    init: true
+    shm_size: 64M
+    restart: on-failure
+    extra_hosts:
+    - "somehost:162.242.195.82"
+    stop_signal: SIGUSR1
+    stop_grace_period: 1m30s
+  worker:
+    build: ./worker
+    labels:
+      team: core
+    env_file:
+    - a.env
+    - b.env
+    tmpfs:
+    - /run
+    - /tmp
+`
+
+	var cfg Config
+	require.NoError(t, yaml.Unmarshal([]byte(yamlSource), &cfg))
+
+	app := cfg.Services["app"]
+	require.Equal(t, &Build{Context: "./app", Dockerfile: "Dockerfile.dev", Args: Mapping{"VERSION": "1.0"}, Target: "dev"}, app.Build)
+	assert.Equal(t, "app", app.ContainerName)
+	assert.Equal(t, Mapping{"team": "core", "tier": ""}, app.Labels)
+	assert.Equal(t, StringList{".env"}, app.EnvFile)
+	assert.Equal(t, "1000:1000", app.User)
+	assert.Equal(t, "/srv", app.WorkingDir)
+	assert.Equal(t, map[string]*Ulimit{"nproc": {Single: 65535}, "nofile": {Soft: 20000, Hard: 40000}}, app.Ulimits)
+	assert.Equal(t, StringList{"/run"}, app.Tmpfs)
+	assert.Equal(t, []string{"NET_ADMIN"}, app.CapAdd)
+	assert.Equal(t, []string{"ALL"}, app.CapDrop)
+	assert.True(t, app.Privileged)
+	assert.True(t, app.Init)
+	assert.Equal(t, "64M", app.ShmSize)
+	assert.Equal(t, "on-failure", app.Restart)
+	assert.Equal(t, []string{"somehost:162.242.195.82"}, app.ExtraHosts)
+	assert.Equal(t, "SIGUSR1", app.StopSignal)
+	assert.Equal(t, "1m30s", app.StopGracePeriod)
+	assert.Empty(t, app.Extension)
+
+	worker := cfg.Services["worker"]
+	require.Equal(t, &Build{Context: "./worker"}, worker.Build)
+	assert.Equal(t, Mapping{"team": "core"}, worker.Labels)
+	assert.Equal(t, StringList{"a.env", "b.env"}, worker.EnvFile)
+	assert.Equal(t, StringList{"/run", "/tmp"}, worker.Tmpfs)
+
+	bs, err := yaml.Marshal(cfg)
+	require.NoError(t, err)
+	assert.Contains(t, string(bs), "build: ./worker")
+	assert.Contains(t, string(bs), "nproc: 65535")
+
+	var roundTripped Config
+	require.NoError(t, yaml.Unmarshal(bs, &roundTripped))
+	require.Equal(t, cfg, roundTripped)
+}
+
+func TestHealthCheckTest(t *testing.T) {
+	const yamlSource = `
+services:
+  web:
+    image: nginx
+    healthcheck:
+      test: curl -f http://localhost
+  db:
+    image: postgres
+    healthcheck:
+      test: ["CMD", "pg_isready"]
+`
+	var cfg Config
+	require.NoError(t, yaml.Unmarshal([]byte(yamlSource), &cfg))
+	assert.Equal(t, HealthCheckTest{"CMD-SHELL", "curl -f http://localhost"}, cfg.Services["web"].HealthCheck.Test)
+	assert.Equal(t, HealthCheckTest{"CMD", "pg_isready"}, cfg.Services["db"].HealthCheck.Test)
+	require.NoError(t, cfg.Validate())
+
+	bs, err := yaml.Marshal(cfg)
+	require.NoError(t, err)
+	assert.Contains(t, string(bs), "test: curl -f http://localhost")
+
+	var roundTripped Config
+	require.NoError(t, yaml.Unmarshal(bs, &roundTripped))
+	require.Equal(t, cfg, roundTripped)
+}
+
+func TestParsePortSpec(t *testing.T) {
+	for spec, want := range map[string][]ServicePort{
+		"3000":                  {{Target: 3000}},
+		"3000/udp":              {{Target: 3000, Protocol: "udp"}},
+		"8080:80":               {{Target: 80, Published: "8080"}},
+		"127.0.0.1:8080:80/tcp": {{HostIP: "127.0.0.1", Target: 80, Published: "8080", Protocol: "tcp"}},
+		"127.0.0.1::80":         {{HostIP: "127.0.0.1", Target: 80}},
+		"[::1]:8080:80":         {{HostIP: "::1", Target: 80, Published: "8080"}},
+		"8000-8010:80":          {{Target: 80, Published: "8000-8010"}},
+		"9000-9001":             {{Target: 9000}, {Target: 9001}},
+		"8000-8001:9000-9001":   {{Target: 9000, Published: "8000"}, {Target: 9001, Published: "8001"}},
+	} {
+		got, err := parsePortSpec(spec)
+		require.NoError(t, err, spec)
+		require.Equal(t, want, got, spec)
+	}
+	for _, spec := range []string{"", "http", "0", "65536", ":8080:80", "8010-8000", "8000-8010:9000-9005"} {
+		_, err := parsePortSpec(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestSplitShell(t *testing.T) {
+	for in, want := range map[string][]string{
+		"/gnatsd -DV":                    {"/gnatsd", "-DV"},
+		"  sh  -c 'echo $HOME; exit 1' ": {"sh", "-c", "echo $HOME; exit 1"},
+		`echo "a \"quoted\" \w" b\ c`:    {"echo", `a "quoted" \w`, "b c"},
+		`printf ""`:                      {"printf", ""},
+		"":                               nil,
+	} {
+		got, err := splitShell(in)
+		require.NoError(t, err, in)
+		require.Equal(t, want, got, in)
+	}
+	for _, in := range []string{`echo 'unterminated`, `echo "unterminated`, `echo \`} {
+		_, err := splitShell(in)
+		require.Error(t, err, in)
+	}
+}
+
+func TestShortAndLongSyntax(t *testing.T) {
+	const yamlSource = `
+services:
+  app:
+    image: app
+    command: serve --port "8080"
+    entrypoint: ["/tini", "--"]
+    environment:
+      LOG_LEVEL: debug
+      WORKERS: 4
+      HOME:
+    ports:
+    - 8080
+    - "127.0.0.1:9090:9090/udp"
+    - target: 80
+      published: 8000
+      protocol: tcp
+      mode: host
+    depends_on:
+      db:
+        condition: service_healthy
+      cache:
+        condition: service_started
+  worker:
+    image: worker
+    environment:
+    - LOG_LEVEL=info
+    depends_on:
+    - db
+  db:
+    image: postgres
+  cache:
+    image: redis
+`
+
+	var cfg Config
+	require.NoError(t, yaml.Unmarshal([]byte(yamlSource), &cfg))
+
+	app := cfg.Services["app"]
+	assert.Equal(t, ShellCommand{"serve", "--port", "8080"}, app.Command)
+	assert.Equal(t, ShellCommand{"/tini", "--"}, app.Entrypoint)
+	assert.Equal(t, Environment{"HOME", "LOG_LEVEL=debug", "WORKERS=4"}, app.Environment)
+	assert.Equal(t, ServicePorts{
+		{Target: 8080},
+		{HostIP: "127.0.0.1", Target: 9090, Published: "9090", Protocol: "udp"},
+		{Mode: "host", Target: 80, Published: "8000", Protocol: "tcp"},
+	}, app.Ports)
+	assert.Equal(t, ServiceDependencies{
+		"db":    {Condition: ConditionServiceHealthy},
+		"cache": {Condition: ConditionServiceStarted},
+	}, app.DependsOn)
+
+	worker := cfg.Services["worker"]
+	assert.Equal(t, Environment{"LOG_LEVEL=info"}, worker.Environment)
+	assert.Equal(t, ServiceDependencies{"db": {Condition: ConditionServiceStarted}}, worker.DependsOn)
+
+	bs, err := yaml.Marshal(cfg)
+	require.NoError(t, err)
+	assert.Contains(t, string(bs), "- 127.0.0.1:9090:9090/udp")
+	assert.Contains(t, string(bs), "condition: service_healthy")
+	assert.Contains(t, string(bs), "depends_on:\n    - db\n")
+
+	var roundTripped Config
+	require.NoError(t, yaml.Unmarshal(bs, &roundTripped))
+	require.Equal(t, cfg, roundTripped)
+
+	// the map syntax requires a condition for every dependency
+	bs, err = yaml.Marshal(ServiceDependencies{"db": {Condition: ConditionServiceHealthy}, "cache": {}})
+	require.NoError(t, err)
+	assert.Equal(t, "cache:\n  condition: service_started\ndb:\n  condition: service_healthy\n", string(bs))
+}
+
+func TestNetworks(t *testing.T) {
+	const yamlSource = `
+services:
+  app:
+    image: app
+    networks:
+      frontend:
+        aliases:
+        - api
+      backend:
+        ipv4_address: 172.16.238.10
+      legacy:
+  db:
+    image: postgres
+    networks:
+    - backend
+networks:
+  frontend:
+    external: true
+  legacy:
+    external:
+      name: legacy-net
+  backend:
+    driver: bridge
+    driver_opts:
+      com.docker.network.bridge.enable_icc: "true"
+    internal: true
+    attachable: true
+    ipam:
+      driver: default
+      config:
+      - subnet: 172.16.238.0/24
+        gateway: 172.16.238.1
+`
+
+	var cfg Config
+	require.NoError(t, yaml.Unmarshal([]byte(yamlSource), &cfg))
+	require.NoError(t, cfg.Validate())
+
+	assert.Equal(t, External{External: true}, cfg.Networks["frontend"].External)
+	assert.Equal(t, External{External: true, Name: "legacy-net"}, cfg.Networks["legacy"].External)
+	backend := cfg.Networks["backend"]
+	assert.Equal(t, "bridge", backend.Driver)
+	assert.Equal(t, map[string]string{"com.docker.network.bridge.enable_icc": "true"}, backend.DriverOpts)
+	assert.True(t, backend.Internal)
+	assert.True(t, backend.Attachable)
+	assert.Equal(t, &IPAM{Driver: "default", Config: []IPAMPool{{Subnet: "172.16.238.0/24", Gateway: "172.16.238.1"}}}, backend.IPAM)
+	assert.Empty(t, backend.External)
+
+	assert.Equal(t, ServiceNetworks{
+		"frontend": {Aliases: []string{"api"}},
+		"backend":  {IPv4Address: "172.16.238.10"},
+		"legacy":   nil,
+	}, cfg.Services["app"].Networks)
+	assert.Equal(t, ServiceNetworks{"backend": nil}, cfg.Services["db"].Networks)
+
+	bs, err := yaml.Marshal(cfg)
+	require.NoError(t, err)
+	assert.Contains(t, string(bs), "external: true")
+	assert.Contains(t, string(bs), "name: legacy-net")
+	assert.NotContains(t, string(bs), "external: false")
+
+	var roundTripped Config
+	require.NoError(t, yaml.Unmarshal(bs, &roundTripped))
+	require.Equal(t, cfg, roundTripped)
+}
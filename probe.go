@@ -0,0 +1,227 @@
+package dccli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// defaultProbeTimeout bounds a single attempt of a probe run by WaitFor, unless the probe sets a timeout of its own.
+const defaultProbeTimeout = 5 * time.Second
+
+// Probe checks whether a service is ready, returning an error for as long as it is not.
+type Probe interface {
+	Probe(ctx context.Context, c *Compose, service string) error
+}
+
+// timeoutProbe is implemented by the probes which configure the timeout of a single attempt.
+type timeoutProbe interface {
+	timeout() time.Duration
+}
+
+// ProbeFunc adapts an ordinary function to the Probe interface.
+type ProbeFunc func(ctx context.Context, c *Compose, service string) error
+
+// Probe calls f(ctx, c, service).
+func (f ProbeFunc) Probe(ctx context.Context, c *Compose, service string) error {
+	return f(ctx, c, service)
+}
+
+// ProbeWithTimeout returns a probe which runs p, bounding each of its attempts run by WaitFor by timeout instead of the
+// default of 5 seconds. It is meant for probes without a Timeout of their own, such as a ProbeFunc.
+func ProbeWithTimeout(p Probe, timeout time.Duration) Probe {
+	return timedProbe{p: p, t: timeout}
+}
+
+type timedProbe struct {
+	p Probe
+	t time.Duration
+}
+
+func (p timedProbe) Probe(ctx context.Context, c *Compose, service string) error {
+	return p.p.Probe(ctx, c, service)
+}
+
+func (p timedProbe) timeout() time.Duration {
+	return p.t
+}
+
+// TCPProbe succeeds once a TCP connection can be made to the container port Port, at the address returned by Compose.Address.
+type TCPProbe struct {
+	Port uint32
+	// Timeout bounds a single attempt when run by WaitFor, defaults to 5 seconds.
+	Timeout time.Duration
+}
+
+// Probe dials the port and closes the connection right away.
+func (p TCPProbe) Probe(ctx context.Context, c *Compose, service string) error {
+	addr, err := c.Address(service, p.Port)
+	if err != nil {
+		return err
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (p TCPProbe) timeout() time.Duration {
+	return p.Timeout
+}
+
+// HTTPProbe succeeds once a GET request to the container port Port, at the address returned by Compose.Address,
+// responds as expected.
+type HTTPProbe struct {
+	Port uint32
+	// Path is the request path, defaults to "/".
+	Path string
+	// Status is the expected status code, defaults to any 2xx status.
+	Status int
+	// Body, if set, has to match the response body.
+	Body *regexp.Regexp
+	// Timeout bounds a single attempt when run by WaitFor, defaults to 5 seconds.
+	Timeout time.Duration
+}
+
+// Probe sends the request and checks the response.
+func (p HTTPProbe) Probe(ctx context.Context, c *Compose, service string) error {
+	addr, err := c.Address(service, p.Port)
+	if err != nil {
+		return err
+	}
+	path := p.Path
+	if path == "" {
+		path = "/"
+	}
+	url := fmt.Sprintf("http://%s%s", addr, path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if p.Status == 0 && (resp.StatusCode < 200 || resp.StatusCode > 299) ||
+		p.Status != 0 && resp.StatusCode != p.Status {
+		return fmt.Errorf("compose: unexpected status from %s: %s", url, resp.Status)
+	}
+	if p.Body == nil {
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+		return err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if !p.Body.Match(body) {
+		return fmt.Errorf("compose: response body from %s does not match %s", url, p.Body)
+	}
+	return nil
+}
+
+func (p HTTPProbe) timeout() time.Duration {
+	return p.Timeout
+}
+
+// ExecProbe succeeds once Cmd exits with status 0 when run inside the service container.
+type ExecProbe struct {
+	Cmd []string
+	// Timeout bounds a single attempt when run by WaitFor, defaults to 5 seconds.
+	Timeout time.Duration
+}
+
+// Probe runs the command using Compose.Exec.
+func (p ExecProbe) Probe(ctx context.Context, c *Compose, service string) error {
+	result, err := c.Exec(ctx, service, p.Cmd, nil)
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("compose: %v exited with %d in service %s: %s", p.Cmd, result.ExitCode, service, result.Stderr)
+	}
+	return nil
+}
+
+func (p ExecProbe) timeout() time.Duration {
+	return p.Timeout
+}
+
+// LogProbe succeeds once the logs of the service container match Pattern.
+type LogProbe struct {
+	Pattern *regexp.Regexp
+	// Timeout bounds a single attempt when run by WaitFor, defaults to 5 seconds.
+	Timeout time.Duration
+}
+
+// Probe fetches the container logs using Compose.Logs.
+func (p LogProbe) Probe(ctx context.Context, c *Compose, service string) error {
+	logs, err := c.Logs(ctx, service, LogOptions{})
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+	out, err := ioutil.ReadAll(logs)
+	if err != nil {
+		return err
+	}
+	if !p.Pattern.Match(out) {
+		return fmt.Errorf("compose: logs of service %s do not match %s yet", service, p.Pattern)
+	}
+	return nil
+}
+
+func (p LogProbe) timeout() time.Duration {
+	return p.Timeout
+}
+
+// WaitFor runs the probes against the service until all of them succeed or the policy gives up retrying.
+// A nil policy retries with exponential backoff. Each attempt of a probe is bounded by its Timeout, or by 5 seconds
+// for probes without one such as a ProbeFunc, so a probe which hangs, for example on a port which accepts connections
+// but never responds, does not block the retries. Use ProbeWithTimeout to give a ProbeFunc a different bound.
+func (c *Compose) WaitFor(ctx context.Context, service string, policy RetryPolicy, probes ...Probe) error {
+	if policy == nil {
+		policy = &ExponentialBackoffRetryPolicy{NumRetries: defaultRetryCount, Min: defaultBaseRetryDelay}
+	}
+	err := c.ConnectContext(ctx, policy, func() error {
+		for _, p := range probes {
+			if err := runProbe(ctx, c, service, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("compose: service %s is not ready: %w", service, err)
+	}
+	return nil
+}
+
+// runProbe runs a single attempt of the probe, bounded by its timeout or by defaultProbeTimeout.
+func runProbe(ctx context.Context, c *Compose, service string, p Probe) error {
+	timeout := defaultProbeTimeout
+	if tp, ok := p.(timeoutProbe); ok && tp.timeout() > 0 {
+		timeout = tp.timeout()
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return p.Probe(ctx, c, service)
+}
+
+// cachedContainer returns the first container of the service as of the last update, without inspecting it again.
+func (c *Compose) cachedContainer(service string) (*ContainerInfo, error) {
+	containers := c.containers[service]
+	if len(containers) == 0 {
+		return nil, fmt.Errorf("compose: no container %s found", service)
+	}
+	return containers[0], nil
+}
@@ -0,0 +1,174 @@
+package dccli
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestTCPProbe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err)
+
+	c := replayCompose(t, nil, withHostPort(port))
+	require.NoError(t, TCPProbe{Port: 3000}.Probe(context.Background(), c, "ms"))
+	require.Error(t, TCPProbe{Port: 1090}.Probe(context.Background(), c, "ms"), "port is not published")
+	require.Error(t, TCPProbe{Port: 3000}.Probe(context.Background(), c, "mysql"), "no such service")
+}
+
+func TestHTTPProbe(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "Hello world!")
+	}))
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	c := replayCompose(t, nil, withHostPort(u.Port()))
+	err = c.WaitFor(context.Background(), "ms", NewSimpleRetryPolicy(5, time.Millisecond),
+		HTTPProbe{Port: 3000, Body: regexp.MustCompile(`Hello`)})
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+
+	err = HTTPProbe{Port: 3000, Status: http.StatusNoContent}.Probe(context.Background(), c, "ms")
+	require.Error(t, err)
+	err = HTTPProbe{Port: 3000, Body: regexp.MustCompile(`Goodbye`)}.Probe(context.Background(), c, "ms")
+	require.Error(t, err)
+}
+
+func TestProbeTimeout(t *testing.T) {
+	// the listener accepts connections, but never answers
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	accepted := make(chan net.Conn, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	require.NoError(t, err)
+
+	c := replayCompose(t, nil, withHostPort(port))
+	err = c.WaitFor(context.Background(), "ms", NewSimpleRetryPolicy(2, time.Millisecond),
+		&HTTPProbe{Port: 3000, Timeout: 50 * time.Millisecond})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "context deadline exceeded")
+	// the listener might not have picked up the last connection yet
+	for deadline := time.Now().Add(time.Second); len(accepted) < 3 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	require.Len(t, accepted, 3, "every retry gets its own attempt")
+
+	// only drain the connections once the accepting goroutine is gone
+	l.Close()
+	<-done
+	close(accepted)
+	for conn := range accepted {
+		conn.Close()
+	}
+}
+
+func TestExecProbe(t *testing.T) {
+	e := NewReplayExecutor(
+		RecordedCommand{Args: []string{"docker", "exec", msID, "pg_isready"}, ExitCode: 2},
+		RecordedCommand{Args: []string{"docker", "exec", msID, "pg_isready"}},
+	)
+	c := replayCompose(t, e)
+
+	err := c.WaitFor(context.Background(), "ms", NewSimpleRetryPolicy(1, time.Millisecond),
+		ExecProbe{Cmd: []string{"pg_isready"}})
+	require.NoError(t, err)
+	require.Empty(t, e.Pending())
+}
+
+func TestLogProbe(t *testing.T) {
+	e := NewReplayExecutor(
+		RecordedCommand{Args: []string{"docker", "logs", msID}, Stdout: "starting\n"},
+		RecordedCommand{Args: []string{"docker", "logs", msID}, Stdout: "starting\n", Stderr: "serving at port 3000\n"},
+	)
+	c := replayCompose(t, e)
+
+	p := LogProbe{Pattern: regexp.MustCompile(`serving at port \d+`)}
+	require.Error(t, p.Probe(context.Background(), c, "ms"))
+	require.NoError(t, p.Probe(context.Background(), c, "ms"))
+}
+
+func TestWaitForGivesUp(t *testing.T) {
+	c := replayCompose(t, nil)
+
+	tries := 0
+	err := c.WaitFor(context.Background(), "ms", NewSimpleRetryPolicy(2, time.Millisecond),
+		ProbeFunc(func(ctx context.Context, c *Compose, service string) error {
+			tries++
+			return fmt.Errorf("%s is not ready", service)
+		}))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "service ms is not ready: ms is not ready")
+	require.Equal(t, 3, tries)
+}
+
+// blockingExecutor runs commands which never finish, until their context is done.
+type blockingExecutor struct{}
+
+func (blockingExecutor) Execute(ctx context.Context, cmd Command) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestEveryProbeIsBounded(t *testing.T) {
+	c := replayCompose(t, blockingExecutor{})
+
+	var remaining time.Duration
+	err := c.WaitFor(context.Background(), "ms", NewSimpleRetryPolicy(0, time.Millisecond),
+		ProbeFunc(func(ctx context.Context, c *Compose, service string) error {
+			deadline, ok := ctx.Deadline()
+			if !ok {
+				return fmt.Errorf("no deadline")
+			}
+			remaining = time.Until(deadline)
+			return nil
+		}))
+	require.NoError(t, err)
+	require.True(t, remaining > 0 && remaining <= defaultProbeTimeout, "probes without a timeout get the default one")
+
+	err = c.WaitFor(context.Background(), "ms", NewSimpleRetryPolicy(0, time.Millisecond),
+		ProbeWithTimeout(ProbeFunc(func(ctx context.Context, c *Compose, service string) error {
+			deadline, ok := ctx.Deadline()
+			if !ok {
+				return fmt.Errorf("no deadline")
+			}
+			remaining = time.Until(deadline)
+			return nil
+		}), time.Minute))
+	require.NoError(t, err)
+	require.True(t, remaining > defaultProbeTimeout && remaining <= time.Minute, "ProbeWithTimeout overrides the default")
+
+	err = c.WaitFor(context.Background(), "ms", NewSimpleRetryPolicy(1, time.Millisecond),
+		ExecProbe{Cmd: []string{"pg_isready"}, Timeout: 10 * time.Millisecond})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "context deadline exceeded", "a hanging docker exec is given up on")
+}
@@ -0,0 +1,163 @@
+package dccli
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Labels dccli attaches to every service it starts with OptionReaper, used to find projects left behind by crashed test runs.
+const (
+	LabelSession = "dccli.session"
+	LabelCreated = "dccli.created"
+)
+
+// sessionID identifies the projects started by the current process.
+var sessionID = newSessionID()
+
+func newSessionID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// withSessionLabels returns a copy of cfg in which every service is labeled with the current session.
+func withSessionLabels(cfg Config, created time.Time) Config {
+	services := make(map[string]Service, len(cfg.Services))
+	for name, svc := range cfg.Services {
+		labels := make(Mapping, len(svc.Labels)+2)
+		for k, v := range svc.Labels {
+			labels[k] = v
+		}
+		labels[LabelSession] = sessionID
+		labels[LabelCreated] = strconv.FormatInt(created.Unix(), 10)
+		svc.Labels = labels
+		services[name] = svc
+	}
+	cfg.Services = services
+	return cfg
+}
+
+// reaperScript waits for a line on stdin, and brings the project down unless it reads "cancel".
+// Reading fails once the owning process exits and the other end of the pipe is closed, even when it got SIGKILLed.
+const reaperScript = `read -r line; [ "$line" = cancel ] && exit 0; exec "$@" down -v --remove-orphans`
+
+// reaper is a watchdog process removing the project once the owning process exits without cleaning up.
+type reaper struct {
+	stdin io.WriteCloser
+}
+
+// startReaper spawns the watchdog process for the project.
+func startReaper(cfg *internalCFG) (*reaper, error) {
+	if runtime.GOOS == "windows" {
+		return nil, fmt.Errorf("compose: the reaper is not supported on %s", runtime.GOOS)
+	}
+	name, composeCmd := composeArgs(cfg)
+	args := append([]string{"-c", reaperScript, "dccli-reaper", name}, composeCmd...)
+
+	r, w := io.Pipe()
+	go func() {
+		// the watchdog has to outlive the context passed to Start
+		err := cfg.executor.Execute(context.Background(), Command{Name: "sh", Args: args, Stdin: r})
+		if err != nil {
+			cfg.logger.Printf("reaper for project %s failed: %v", cfg.projectName, err)
+		}
+		r.Close()
+	}()
+	return &reaper{stdin: w}, nil
+}
+
+// cancel tells the watchdog process to exit without removing the project.
+func (r *reaper) cancel() {
+	io.WriteString(r.stdin, "cancel\n")
+	r.stdin.Close()
+}
+
+// ReapStale removes the containers, networks and volumes of projects started with OptionReaper in other processes
+// more than olderThan ago, which were never cleaned up. It returns the names of the removed projects.
+func ReapStale(olderThan time.Duration) ([]string, error) {
+	return ReapStaleContext(context.Background(), olderThan)
+}
+
+// ReapStaleContext is like ReapStale, but aborts once ctx is done.
+func ReapStaleContext(ctx context.Context, olderThan time.Duration) ([]string, error) {
+	return reapStale(ctx, ExecExecutor{}, olderThan)
+}
+
+func reapStale(ctx context.Context, e Executor, olderThan time.Duration) ([]string, error) {
+	format := fmt.Sprintf(`{{.Label "%s"}}\t{{.Label "%s"}}\t{{.Label "%s"}}`, labelProject, LabelSession, LabelCreated)
+	out, err := runCmd(ctx, e, "docker", "ps", "-a", "--filter", "label="+LabelSession, "--format", format)
+	if err != nil {
+		return nil, fmt.Errorf("compose: error listing dccli containers: %w", err)
+	}
+
+	// a project is stale once its most recently created container is, and it doesn't belong to this process
+	newest := make(map[string]time.Time)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) != 3 || fields[0] == "" {
+			continue
+		}
+		project, session := fields[0], fields[1]
+		if session == sessionID {
+			newest[project] = time.Now()
+			continue
+		}
+		created, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		if t := time.Unix(created, 0); t.After(newest[project]) {
+			newest[project] = t
+		}
+	}
+
+	var stale []string
+	for project, created := range newest {
+		if time.Since(created) > olderThan {
+			stale = append(stale, project)
+		}
+	}
+	sort.Strings(stale)
+
+	var reaped []string
+	var errs []error
+	for _, project := range stale {
+		if err := removeProject(ctx, e, project); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		reaped = append(reaped, project)
+	}
+	return reaped, combineErr(errs...)
+}
+
+// removeProject removes everything labeled for the project, for when the compose file is no longer around to run `down`.
+func removeProject(ctx context.Context, e Executor, project string) error {
+	cfg := &internalCFG{projectName: project, executor: e}
+	filter := "label=" + labelProject + "=" + project
+
+	out, err := dockerRun(ctx, cfg, "ps", "-a", "-q", "--filter", filter)
+	if err != nil {
+		return fmt.Errorf("compose: error listing containers of project %s: %w", project, err)
+	}
+	if ids := strings.Fields(out); len(ids) > 0 {
+		if _, err := dockerRun(ctx, cfg, append([]string{"rm", "-f", "-v"}, ids...)...); err != nil {
+			return fmt.Errorf("compose: error removing containers of project %s: %w", project, err)
+		}
+	}
+
+	if err := composeRMNetworks(ctx, cfg); err != nil {
+		return err
+	}
+	return composeRMVolumes(ctx, cfg, nil)
+}
@@ -0,0 +1,79 @@
+package dccli
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// echoExecutor runs commands on the host, but echoes the docker-compose invocations instead of running them.
+type echoExecutor struct {
+	out  bytes.Buffer
+	done chan struct{}
+}
+
+func (e *echoExecutor) Execute(ctx context.Context, cmd Command) error {
+	defer close(e.done)
+	for i, arg := range cmd.Args {
+		if arg == "docker-compose" {
+			cmd.Args[i] = "echo"
+		}
+	}
+	cmd.Stdout = &e.out
+	return ExecExecutor{}.Execute(ctx, cmd)
+}
+
+func TestReaperRunsDownWhenOwnerGoesAway(t *testing.T) {
+	e := &echoExecutor{done: make(chan struct{})}
+	r, err := startReaper(&internalCFG{outFile: "docker-compose.yaml", projectName: "dccli", backend: BackendV1, executor: e, logger: quietLogger})
+	require.NoError(t, err)
+
+	// closing stdin without cancelling is what happens when the owning process dies
+	r.stdin.Close()
+	<-e.done
+	require.Equal(t, "-f docker-compose.yaml -p dccli down -v --remove-orphans\n", e.out.String())
+}
+
+func TestReaperCancel(t *testing.T) {
+	e := &echoExecutor{done: make(chan struct{})}
+	r, err := startReaper(&internalCFG{outFile: "docker-compose.yaml", projectName: "dccli", backend: BackendV1, executor: e, logger: quietLogger})
+	require.NoError(t, err)
+
+	r.cancel()
+	<-e.done
+	require.Empty(t, e.out.String())
+}
+
+func TestWithSessionLabels(t *testing.T) {
+	in := Config{Services: map[string]Service{"app": {Image: "app", Labels: Mapping{"team": "core"}}}}
+	out := withSessionLabels(in, time.Unix(1600000000, 0))
+
+	require.Equal(t, Mapping{"team": "core", LabelSession: sessionID, LabelCreated: "1600000000"}, out.Services["app"].Labels)
+	require.Equal(t, Mapping{"team": "core"}, in.Services["app"].Labels, "the passed in configuration is left alone")
+}
+
+func TestReapStale(t *testing.T) {
+	old := strconv.FormatInt(time.Now().Add(-2*time.Hour).Unix(), 10)
+	recent := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	psOut := "crashed\tdeadbeef\t" + old + "\n" +
+		"crashed\tdeadbeef\t" + old + "\n" +
+		"running\tcafebabe\t" + recent + "\n" +
+		"ours\t" + sessionID + "\t" + old + "\n"
+
+	e := NewReplayExecutor(
+		RecordedCommand{Args: []string{"docker", "ps", "-a", "--filter", "label=dccli.session", "--format", AnyArg}, Stdout: psOut},
+		RecordedCommand{Args: []string{"docker", "ps", "-a", "-q", "--filter", "label=com.docker.compose.project=crashed"}, Stdout: "aaa\nbbb\n"},
+		RecordedCommand{Args: []string{"docker", "rm", "-f", "-v", "aaa", "bbb"}},
+		RecordedCommand{Args: []string{"docker", "network", "ls", "-q", "--filter", "label=com.docker.compose.project=crashed"}, Stdout: "net1\n"},
+		RecordedCommand{Args: []string{"docker", "network", "rm", "net1"}},
+		RecordedCommand{Args: []string{"docker", "volume", "ls", "-q", "--filter", "label=com.docker.compose.project=crashed"}},
+	)
+
+	reaped, err := reapStale(context.Background(), e, time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, []string{"crashed"}, reaped)
+	require.Empty(t, e.Pending())
+}
@@ -0,0 +1,125 @@
+package dccli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+)
+
+var unsafePathRegexp = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// StartT is like Start, but ties the configuration to a test: the test fails if it cannot be started,
+// and the configuration is cleaned up once the test and all its subtests complete.
+// If the test failed, or the containers started but did not become ready, the logs and `docker inspect` output
+// of every service and the `ps` output are written to a per-test directory below the directory set by
+// OptionArtifactDir before cleaning up.
+func StartT(t testing.TB, opts ...Option) *Compose {
+	t.Helper()
+	c, err := startContext(context.Background(), opts...)
+	if err != nil {
+		if c != nil {
+			// starting the containers was attempted, the artifacts show how far they got
+			dumpArtifactsT(t, c)
+			if err := c.Cleanup(); err != nil {
+				t.Errorf("compose: error cleaning up: %v", err)
+			}
+		}
+		t.Fatalf("compose: error starting: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if t.Failed() {
+			dumpArtifactsT(t, c)
+		}
+		if err := c.Cleanup(); err != nil {
+			t.Errorf("compose: error cleaning up: %v", err)
+		}
+	})
+	return c
+}
+
+// dumpArtifactsT writes the artifacts to a directory named after the test, logging where they went.
+func dumpArtifactsT(t testing.TB, c *Compose) {
+	t.Helper()
+	dir := filepath.Join(c.cfg.artifactDir, unsafePathRegexp.ReplaceAllString(t.Name(), "_"))
+	if err := c.DumpArtifacts(dir); err != nil {
+		t.Logf("compose: error writing artifacts: %v", err)
+	} else {
+		t.Logf("compose: wrote logs and container state to %s", dir)
+	}
+}
+
+// DumpArtifacts writes the logs and `docker inspect` output of every service, as well as the `ps` output
+// of the project into dir, for diagnosing failed tests.
+func (c *Compose) DumpArtifacts(dir string) error {
+	ctx := context.Background()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("compose: error creating artifact directory: %v", err)
+	}
+
+	var errs []error
+	ps, err := composeRun(ctx, &c.cfg, "ps")
+	if err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, writeArtifact(dir, "ps.txt", ps))
+
+	// refresh the containers to capture the state they are in now, falling back to the last known one
+	if err := c.updateContainers(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	var services []string
+	for service := range c.containers {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	for _, service := range services {
+		replicas := c.containers[service]
+		for i, container := range replicas {
+			// scaled services get one set of files per replica
+			name := service
+			if len(replicas) > 1 {
+				name = fmt.Sprintf("%s-%d", service, i+1)
+			}
+			out, err := dockerRun(ctx, &c.cfg, "inspect", container.ID)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			errs = append(errs, writeArtifact(dir, name+".inspect.json", out))
+			errs = append(errs, c.dumpLogs(ctx, dir, name, container))
+		}
+	}
+	return combineErr(errs...)
+}
+
+func (c *Compose) dumpLogs(ctx context.Context, dir, name string, container *ContainerInfo) error {
+	logs, err := c.containerLogs(ctx, "container "+container.Name, container, LogOptions{Timestamps: true})
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	f, err := os.Create(filepath.Join(dir, name+".log"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, logs)
+	return err
+}
+
+func writeArtifact(dir, name, content string) error {
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(content)
+	return err
+}
@@ -0,0 +1,158 @@
+package dccli
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeTB lets a test control whether StartT sees a failed test.
+type fakeTB struct {
+	testing.TB
+	failed   bool
+	cleanups []func()
+	logs     []string
+}
+
+func (f *fakeTB) Helper()           {}
+func (f *fakeTB) Name() string      { return "TestSomething/sub case" }
+func (f *fakeTB) Failed() bool      { return f.failed }
+func (f *fakeTB) Cleanup(fn func()) { f.cleanups = append(f.cleanups, fn) }
+func (f *fakeTB) Logf(format string, args ...interface{}) {
+	f.logs = append(f.logs, fmt.Sprintf(format, args...))
+}
+func (f *fakeTB) Errorf(format string, args ...interface{}) {
+	f.failed = true
+	f.Logf(format, args...)
+}
+
+// fakeFatal is what fakeTB.Fatalf panics with, as it has to stop the caller like testing.TB.Fatalf does.
+type fakeFatal struct{}
+
+func (f *fakeTB) Fatalf(format string, args ...interface{}) {
+	f.Errorf(format, args...)
+	panic(fakeFatal{})
+}
+
+func (f *fakeTB) runCleanups() {
+	for i := len(f.cleanups) - 1; i >= 0; i-- {
+		f.cleanups[i]()
+	}
+}
+
+func TestStartTDumpsArtifactsOnFailure(t *testing.T) {
+	notInContainer(t)
+	localDocker(t)
+	responses := startResponses()
+	responses = append(responses,
+		RecordedCommand{Args: composeCmd("ps"), Stdout: "Name  State\ndccli_ms_1  Up\n"},
+		RecordedCommand{Args: composeCmd("ps", "-q"), Stdout: msID + "\n"},
+		RecordedCommand{Args: []string{"docker", "inspect", msID}, Stdout: inspectOutput(msID, "dccli_ms_1", "ms")},
+		RecordedCommand{Args: []string{"docker", "inspect", msID}, Stdout: "[{\"Id\": \"raw\"}]"},
+		RecordedCommand{Args: []string{"docker", "logs", "--timestamps", msID}, Stdout: "serving at port 3000\n"},
+	)
+	responses = append(responses, cleanupResponses()...)
+	e := NewReplayExecutor(responses...)
+
+	dir := t.TempDir()
+	tb := &fakeTB{failed: true}
+	StartT(tb, OptionWithCompose(cfg),
+		OptionWithLogger(quietLogger),
+		OptionBackend(BackendV1),
+		OptionWithExecutor(e),
+		OptionArtifactDir(dir))
+	tb.runCleanups()
+	require.Empty(t, e.Pending())
+
+	testDir := filepath.Join(dir, "TestSomething_sub_case")
+	for file, expected := range map[string]string{
+		"ps.txt":          "Name  State\ndccli_ms_1  Up\n",
+		"ms.inspect.json": "[{\"Id\": \"raw\"}]",
+		"ms.log":          "serving at port 3000\n",
+	} {
+		content, err := ioutil.ReadFile(filepath.Join(testDir, file))
+		require.NoError(t, err)
+		require.Equal(t, expected, string(content))
+	}
+}
+
+func TestStartTDumpsArtifactsWhenNotReady(t *testing.T) {
+	notInContainer(t)
+	localDocker(t)
+	responses := startResponses()
+	responses = append(responses, healthResponses(`{"Running": false, "ExitCode": 137, "Health": {"Status": "starting"}}`)...)
+	responses = append(responses,
+		RecordedCommand{Args: composeCmd("ps"), Stdout: "Name  State\ndccli_ms_1  Exit 137\n"},
+		RecordedCommand{Args: composeCmd("ps", "-q"), Stdout: msID + "\n"},
+		RecordedCommand{Args: []string{"docker", "inspect", msID}, Stdout: inspectOutput(msID, "dccli_ms_1", "ms")},
+		RecordedCommand{Args: []string{"docker", "inspect", msID}, Stdout: "[{\"Id\": \"raw\"}]"},
+		RecordedCommand{Args: []string{"docker", "logs", "--timestamps", msID}, Stdout: "out of memory\n"},
+	)
+	responses = append(responses, cleanupResponses()...)
+	e := NewReplayExecutor(responses...)
+
+	dir := t.TempDir()
+	tb := &fakeTB{}
+	require.PanicsWithValue(t, fakeFatal{}, func() {
+		StartT(tb, OptionWithCompose(cfg),
+			OptionWithLogger(quietLogger),
+			OptionBackend(BackendV1),
+			OptionWithExecutor(e),
+			OptionWaitHealthy(time.Minute),
+			OptionArtifactDir(dir))
+	})
+	require.True(t, tb.failed)
+	require.Empty(t, tb.cleanups)
+	require.Empty(t, e.Pending(), "the artifacts are written and the containers cleaned up")
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "TestSomething_sub_case", "ms.log"))
+	require.NoError(t, err)
+	require.Equal(t, "out of memory\n", string(content))
+}
+
+func TestStartTDumpsArtifactsWhenUpFails(t *testing.T) {
+	notInContainer(t)
+	localDocker(t)
+	responses := []RecordedCommand{
+		{Args: composeCmd("up", "-d"), Stderr: "ERROR: for ms  Cannot start service ms\n", ExitCode: 1},
+		{Args: composeCmd("ps"), Stdout: "Name  State\ndccli_ms_1  Exit 1\n"},
+		{Args: composeCmd("ps", "-q")},
+	}
+	responses = append(responses, cleanupResponses()...)
+	e := NewReplayExecutor(responses...)
+
+	dir := t.TempDir()
+	tb := &fakeTB{}
+	require.PanicsWithValue(t, fakeFatal{}, func() {
+		StartT(tb, OptionWithCompose(cfg),
+			OptionWithLogger(quietLogger),
+			OptionBackend(BackendV1),
+			OptionStartRetries(1),
+			OptionWithExecutor(e),
+			OptionArtifactDir(dir))
+	})
+	require.True(t, tb.failed)
+	require.Empty(t, e.Pending(), "the artifacts are written and the containers cleaned up")
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "TestSomething_sub_case", "ps.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "Name  State\ndccli_ms_1  Exit 1\n", string(content))
+}
+
+func TestStartTCleansUp(t *testing.T) {
+	notInContainer(t)
+	localDocker(t)
+	e := NewReplayExecutor(append(startResponses(), cleanupResponses()...)...)
+
+	tb := &fakeTB{}
+	StartT(tb, OptionWithCompose(cfg),
+		OptionWithLogger(quietLogger),
+		OptionBackend(BackendV1),
+		OptionWithExecutor(e))
+	tb.runCleanups()
+	require.False(t, tb.failed)
+	require.Empty(t, e.Pending())
+}
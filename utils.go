@@ -1,28 +1,29 @@
 package dccli
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"os"
-	"regexp"
 )
 
-var dockerHostRegexp = regexp.MustCompile("://([^:]+):")
-
-// InferDockerHost returns the current docker host based on the contents of the DOCKER_HOST environment variable.
-// If DOCKER_HOST is not set, it returns "localhost".
+// InferDockerHost returns the host the ports published by the Docker daemon are reached at, based on the endpoint
+// returned by ResolveDockerEndpoint: the host of remote daemons, and "127.0.0.1" for daemons reached through a local
+// socket, or the address of the Docker host as seen from the container when running inside one,
+// e.g. in a CI job with the Docker socket mounted. Containers on the host network also use "127.0.0.1".
+// IPv6 hosts are returned without brackets, such as "::1", so use net.JoinHostPort to add a port.
 func InferDockerHost() (string, error) {
-	envHost := os.Getenv("DOCKER_HOST")
-	if len(envHost) == 0 {
-		return "127.0.0.1", nil
-	}
+	return inferDockerHost(context.Background(), ExecExecutor{})
+}
 
-	matches := dockerHostRegexp.FindAllStringSubmatch(envHost, -1)
-	if len(matches) != 1 || len(matches[0]) != 2 {
-		return "", fmt.Errorf("compose: cannot parse DOCKER_HOST '%v'", envHost)
+// inferDockerHost is InferDockerHost, running docker with x and giving up on looking up the Docker host
+// once ctx is done.
+func inferDockerHost(ctx context.Context, x Executor) (string, error) {
+	e, err := ResolveDockerEndpoint()
+	if err != nil {
+		return "", err
 	}
-	return matches[0][1], nil
+	return e.publishHost(ctx, x), nil
 }
 
 // MustInferDockerHost is like InferDockerHost, but panics on error.
@@ -70,3 +71,12 @@ func combineErr(errs ...error) error {
 
 	return errors.New(root)
 }
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package dccli
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValidationError describes a single problem found by Config.Validate.
+type ValidationError struct {
+	// Service is the name of the service the problem was found in, empty for top-level problems.
+	Service string
+	// Field is the path of the offending field, e.g. "ports[1]" or "healthcheck.interval".
+	Field  string
+	Reason string
+}
+
+func (e ValidationError) Error() string {
+	if e.Service == "" {
+		return fmt.Sprintf("%s: %s", e.Field, e.Reason)
+	}
+	return fmt.Sprintf("service %s: %s: %s", e.Service, e.Field, e.Reason)
+}
+
+// ValidationErrors holds every problem found by Config.Validate.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "compose: invalid configuration:\n\t" + strings.Join(msgs, "\n\t")
+}
+
+// Validate checks the configuration for mistakes docker-compose would only report after a slow startup:
+// invalid ports, dependencies on missing services, dependency cycles, undeclared networks and named volumes,
+// and malformed healthchecks. It returns nil or ValidationErrors.
+func (c Config) Validate() error {
+	var errs ValidationErrors
+	services := make([]string, 0, len(c.Services))
+	for name := range c.Services {
+		services = append(services, name)
+	}
+	sort.Strings(services)
+
+	for _, name := range services {
+		svc := c.Services[name]
+		add := func(field, format string, args ...interface{}) {
+			errs = append(errs, ValidationError{Service: name, Field: field, Reason: fmt.Sprintf(format, args...)})
+		}
+
+		for i, port := range svc.Ports {
+			if err := validatePort(port); err != nil {
+				add(fmt.Sprintf("ports[%d]", i), "%v", err)
+			}
+		}
+		for _, dep := range svc.DependsOn.Services() {
+			if _, ok := c.Services[dep]; !ok {
+				add("depends_on."+dep, "no service %s found", dep)
+			}
+			switch condition := svc.DependsOn[dep].Condition; condition {
+			case "", ConditionServiceStarted, ConditionServiceHealthy, ConditionServiceCompletedSuccessfully:
+			default:
+				add("depends_on."+dep+".condition", "invalid condition %q", condition)
+			}
+		}
+		networks := make([]string, 0, len(svc.Networks))
+		for network := range svc.Networks {
+			networks = append(networks, network)
+		}
+		sort.Strings(networks)
+		for _, network := range networks {
+			field := "networks." + network
+			if _, ok := c.Networks[network]; !ok && network != "default" {
+				add(field, "network %s is not declared in the top-level networks", network)
+			}
+			if cfg := svc.Networks[network]; cfg != nil {
+				if cfg.IPv4Address != "" && (net.ParseIP(cfg.IPv4Address) == nil || net.ParseIP(cfg.IPv4Address).To4() == nil) {
+					add(field+".ipv4_address", "invalid IPv4 address %q", cfg.IPv4Address)
+				}
+				if cfg.IPv6Address != "" && (net.ParseIP(cfg.IPv6Address) == nil || net.ParseIP(cfg.IPv6Address).To4() != nil) {
+					add(field+".ipv6_address", "invalid IPv6 address %q", cfg.IPv6Address)
+				}
+			}
+		}
+		for i, v := range svc.Volumes {
+			field := fmt.Sprintf("volumes[%d]", i)
+			if v == nil || v.Target == "" {
+				add(field, "target is required")
+				continue
+			}
+			if (v.Type == "" || v.Type == "volume") && v.Source != "" && !isHostPath(v.Source) {
+				if _, ok := c.Volumes[v.Source]; !ok {
+					add(field, "volume %s is not declared in the top-level volumes", v.Source)
+				}
+			}
+		}
+
+		hc := svc.HealthCheck
+		if len(hc.Test) > 1 {
+			switch hc.Test[0] {
+			case "NONE", "CMD", "CMD-SHELL":
+			default:
+				add("healthcheck.test[0]", "must be NONE, CMD or CMD-SHELL, got %q", hc.Test[0])
+			}
+		}
+		for _, d := range []struct{ field, value string }{
+			{"interval", hc.Interval}, {"timeout", hc.Timeout}, {"start_period", hc.StartPeriod},
+		} {
+			if d.value == "" {
+				continue
+			}
+			if parsed, err := time.ParseDuration(d.value); err != nil || parsed < 0 {
+				add("healthcheck."+d.field, "invalid duration %q", d.value)
+			}
+		}
+		if hc.Retries != "" {
+			if n, err := strconv.Atoi(hc.Retries); err != nil || n < 0 {
+				add("healthcheck.retries", "must be a non-negative number, got %q", hc.Retries)
+			}
+		}
+	}
+
+	for _, cycle := range dependencyCycles(c, services) {
+		errs = append(errs, ValidationError{
+			Service: cycle[0],
+			Field:   "depends_on",
+			Reason:  "dependency cycle " + strings.Join(cycle, " -> "),
+		})
+	}
+
+	// sort the errors per service, keeping the order they were found in within a service
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Service < errs[j].Service })
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// isHostPath reports whether a volume source refers to a path on the host rather than a named volume.
+func isHostPath(source string) bool {
+	return strings.HasPrefix(source, "/") || strings.HasPrefix(source, ".") || strings.HasPrefix(source, "~")
+}
+
+// dependencyCycles returns each dependency cycle once, as the path from its first service back to itself.
+func dependencyCycles(c Config, services []string) [][]string {
+	const (
+		visiting = iota + 1
+		done
+	)
+	state := make(map[string]int)
+	var cycles [][]string
+	var path []string
+	var visit func(service string)
+	visit = func(service string) {
+		switch state[service] {
+		case done:
+			return
+		case visiting:
+			for i, s := range path {
+				if s == service {
+					cycle := append(append([]string(nil), path[i:]...), service)
+					cycles = append(cycles, cycle)
+				}
+			}
+			return
+		}
+		state[service] = visiting
+		path = append(path, service)
+		for _, dep := range c.Services[service].DependsOn.Services() {
+			if _, ok := c.Services[dep]; ok {
+				visit(dep)
+			}
+		}
+		path = path[:len(path)-1]
+		state[service] = done
+	}
+	for _, service := range services {
+		visit(service)
+	}
+	return cycles
+}
+
+// validatePort checks a port, which the short syntax parser only partially validates.
+func validatePort(p ServicePort) error {
+	if p.Target < 1 || p.Target > 65535 {
+		return fmt.Errorf("target %d is not a port between 1 and 65535", p.Target)
+	}
+	if p.Published != "" {
+		if _, _, err := portRange(p.Published); err != nil {
+			return fmt.Errorf("invalid published port: %v", err)
+		}
+	}
+	switch p.Protocol {
+	case "", "tcp", "udp", "sctp":
+	default:
+		return fmt.Errorf("invalid protocol %q", p.Protocol)
+	}
+	switch p.Mode {
+	case "", "host", "ingress":
+	default:
+		return fmt.Errorf("invalid mode %q", p.Mode)
+	}
+	return nil
+}
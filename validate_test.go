@@ -0,0 +1,62 @@
+package dccli
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, cfg.Validate())
+
+	bad := Config{
+		Volumes:  map[string]interface{}{"data": nil},
+		Networks: map[string]*Network{"backend": nil},
+		Services: map[string]Service{
+			"a": {
+				Image:     "a",
+				Ports:     []ServicePort{{Target: 80}, {Target: 80, Published: "70000"}},
+				DependsOn: ServiceDependencies{"b": {}, "missing": {}},
+				Networks: ServiceNetworks{
+					"backend":  {IPv4Address: "10.0.0.300"},
+					"default":  nil,
+					"frontend": nil,
+				},
+				Volumes: []*Volume{{Source: "data", Target: "/data"}, {Source: "cache", Target: "/cache"}, {Source: "./src"}},
+			},
+			"b": {
+				Image:     "b",
+				DependsOn: ServiceDependencies{"a": {Condition: "started"}},
+				HealthCheck: HealthCheck{
+					Test:     []string{"RUN", "true"},
+					Interval: "10",
+					Timeout:  "5s",
+					Retries:  "three",
+				},
+			},
+		},
+	}
+	err := bad.Validate()
+	require.Error(t, err)
+	errs, ok := err.(ValidationErrors)
+	require.True(t, ok)
+
+	var fields []string
+	for _, e := range errs {
+		fields = append(fields, e.Service+" "+e.Field)
+	}
+	require.Equal(t, []string{
+		"a ports[1]",
+		"a depends_on.missing",
+		"a networks.backend.ipv4_address",
+		"a networks.frontend",
+		"a volumes[1]",
+		"a volumes[2]",
+		"a depends_on",
+		"b depends_on.a.condition",
+		"b healthcheck.test[0]",
+		"b healthcheck.interval",
+		"b healthcheck.retries",
+	}, fields)
+	require.Equal(t, "dependency cycle a -> b -> a", errs[6].Reason)
+	require.Contains(t, err.Error(), "service a: depends_on.missing: no service missing found")
+}